@@ -0,0 +1,98 @@
+package codec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sync"
+)
+
+// ContentTypeAttribute is the message attribute that holds the content type of the body
+const ContentTypeAttribute = "content-type"
+
+// Codec encodes and decodes message bodies of a content type
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	// Binary reports whether the encoded data is binary. SQS bodies must be text, so binary data is base64-encoded.
+	Binary() bool
+}
+
+// Registry holds the codecs by content type. It is safe for concurrent use.
+type Registry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+func NewRegistry(codecs ...Codec) *Registry {
+	registry := &Registry{codecs: make(map[string]Codec)}
+
+	for _, codec := range codecs {
+		registry.Register(codec)
+	}
+
+	return registry
+}
+
+// Register adds the codec, replacing the one registered for the same content type
+func (r *Registry) Register(codec Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.codecs[codec.ContentType()] = codec
+}
+
+// Get returns the codec of the content type
+func (r *Registry) Get(contentType string) (Codec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	codec, ok := r.codecs[contentType]
+
+	return codec, ok
+}
+
+// Default is the registry used by the consumer and the producer. It contains the JSON, Protobuf and MessagePack codecs.
+var Default = NewRegistry(JSON, Protobuf, MessagePack)
+
+// Register adds the codec to the default registry, e.g. to support Avro
+func Register(codec Codec) {
+	Default.Register(codec)
+}
+
+// Get returns the codec of the content type from the default registry
+func Get(contentType string) (Codec, bool) {
+	return Default.Get(contentType)
+}
+
+// Encode marshals v into a message body, base64-encoding binary data
+func Encode(codec Codec, v interface{}) (string, error) {
+	data, err := codec.Marshal(v)
+
+	if err != nil {
+		return "", err
+	}
+
+	if codec.Binary() {
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+
+	return string(data), nil
+}
+
+// Decode unmarshals the message body into v, base64-decoding binary data
+func Decode(codec Codec, body string, v interface{}) error {
+	data := []byte(body)
+
+	if codec.Binary() {
+		decoded, err := base64.StdEncoding.DecodeString(body)
+
+		if err != nil {
+			return fmt.Errorf("failed to decode %s body: %w", codec.ContentType(), err)
+		}
+
+		data = decoded
+	}
+
+	return codec.Unmarshal(data, v)
+}
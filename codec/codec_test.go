@@ -0,0 +1,90 @@
+package codec_test
+
+import (
+	"testing"
+
+	"github.com/inaciogu/go-sqs/codec"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type UnitTest struct {
+	suite.Suite
+}
+
+func TestUnitSuites(t *testing.T) {
+	suite.Run(t, &UnitTest{})
+}
+
+type user struct {
+	Name  string `json:"name" msgpack:"name"`
+	Email string `json:"email" msgpack:"email"`
+}
+
+func (u *UnitTest) TestJSON() {
+	body, err := codec.Encode(codec.JSON, user{Name: "test", Email: "test@test.com"})
+
+	u.NoError(err)
+	u.Equal(`{"name":"test","email":"test@test.com"}`, body)
+
+	decoded := user{}
+
+	u.NoError(codec.Decode(codec.JSON, body, &decoded))
+	u.Equal(user{Name: "test", Email: "test@test.com"}, decoded)
+}
+
+func (u *UnitTest) TestMessagePack() {
+	body, err := codec.Encode(codec.MessagePack, user{Name: "test", Email: "test@test.com"})
+
+	u.NoError(err)
+
+	decoded := user{}
+
+	u.NoError(codec.Decode(codec.MessagePack, body, &decoded))
+	u.Equal(user{Name: "test", Email: "test@test.com"}, decoded)
+}
+
+func (u *UnitTest) TestProtobuf() {
+	body, err := codec.Encode(codec.Protobuf, wrapperspb.String("fake-content"))
+
+	u.NoError(err)
+
+	decoded := &wrapperspb.StringValue{}
+
+	u.NoError(codec.Decode(codec.Protobuf, body, decoded))
+	u.Equal("fake-content", decoded.GetValue())
+}
+
+func (u *UnitTest) TestProtobuf_NotProtoMessage() {
+	_, err := codec.Encode(codec.Protobuf, user{})
+
+	u.ErrorContains(err, "does not implement proto.Message")
+}
+
+func (u *UnitTest) TestDecode_InvalidBase64() {
+	err := codec.Decode(codec.MessagePack, "not base64!", &user{})
+
+	u.ErrorContains(err, "failed to decode application/x-msgpack body")
+}
+
+func (u *UnitTest) TestRegistry() {
+	for _, contentType := range []string{"application/json", "application/x-protobuf", "application/x-msgpack"} {
+		_, ok := codec.Get(contentType)
+
+		u.True(ok, contentType)
+	}
+
+	_, ok := codec.Get("application/avro")
+	u.False(ok)
+
+	registry := codec.NewRegistry(codec.JSON)
+
+	_, ok = registry.Get("application/x-msgpack")
+	u.False(ok)
+
+	registry.Register(codec.MessagePack)
+
+	registered, ok := registry.Get("application/x-msgpack")
+	u.True(ok)
+	u.Equal(codec.MessagePack, registered)
+}
@@ -0,0 +1,24 @@
+package codec
+
+import "encoding/json"
+
+type jsonCodec struct{}
+
+// JSON encodes bodies with encoding/json
+var JSON Codec = jsonCodec{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Binary() bool {
+	return false
+}
@@ -0,0 +1,24 @@
+package codec
+
+import "github.com/vmihailenco/msgpack/v5"
+
+type msgpackCodec struct{}
+
+// MessagePack encodes bodies with MessagePack
+var MessagePack Codec = msgpackCodec{}
+
+func (msgpackCodec) ContentType() string {
+	return "application/x-msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+func (msgpackCodec) Binary() bool {
+	return true
+}
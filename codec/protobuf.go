@@ -0,0 +1,40 @@
+package codec
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+type protobufCodec struct{}
+
+// Protobuf encodes bodies in the protobuf wire format. Values must implement proto.Message.
+var Protobuf Codec = protobufCodec{}
+
+func (protobufCodec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	message, ok := v.(proto.Message)
+
+	if !ok {
+		return nil, fmt.Errorf("%T does not implement proto.Message", v)
+	}
+
+	return proto.Marshal(message)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(proto.Message)
+
+	if !ok {
+		return fmt.Errorf("%T does not implement proto.Message", v)
+	}
+
+	return proto.Unmarshal(data, message)
+}
+
+func (protobufCodec) Binary() bool {
+	return true
+}
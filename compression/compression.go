@@ -0,0 +1,110 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// EncodingAttribute is the message attribute that holds the compression of the body
+const EncodingAttribute = "content-encoding"
+
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// Compress compresses the data with the encoding
+func Compress(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case Gzip:
+		buffer := bytes.Buffer{}
+		writer := gzip.NewWriter(&buffer)
+
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+
+		return buffer.Bytes(), nil
+	case Zstd:
+		encoder, err := zstd.NewWriter(nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer encoder.Close()
+
+		return encoder.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown content encoding %s", encoding)
+	}
+}
+
+// Decompress decompresses the data with the encoding
+func Decompress(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case Gzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer reader.Close()
+
+		return io.ReadAll(reader)
+	case Zstd:
+		decoder, err := zstd.NewReader(nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer decoder.Close()
+
+		return decoder.DecodeAll(data, nil)
+	default:
+		return nil, fmt.Errorf("unknown content encoding %s", encoding)
+	}
+}
+
+// Encode compresses the body and base64-encodes it, since SQS bodies must be text
+func Encode(encoding string, body string) (string, error) {
+	data, err := Compress(encoding, []byte(body))
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decode base64-decodes the body and decompresses it
+func Decode(encoding string, body string) (string, error) {
+	if encoding != Gzip && encoding != Zstd {
+		return "", fmt.Errorf("unknown content encoding %s", encoding)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(body)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s body: %w", encoding, err)
+	}
+
+	data, err = Decompress(encoding, data)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress %s body: %w", encoding, err)
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,49 @@
+package compression_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/inaciogu/go-sqs/compression"
+	"github.com/stretchr/testify/suite"
+)
+
+type UnitTest struct {
+	suite.Suite
+}
+
+func TestUnitSuites(t *testing.T) {
+	suite.Run(t, &UnitTest{})
+}
+
+func (u *UnitTest) TestEncodeAndDecode() {
+	body := `{"content": "` + strings.Repeat("fake-content ", 1000) + `"}`
+
+	for _, encoding := range []string{compression.Gzip, compression.Zstd} {
+		encoded, err := compression.Encode(encoding, body)
+
+		u.NoError(err, encoding)
+		u.Less(len(encoded), len(body), encoding)
+
+		decoded, err := compression.Decode(encoding, encoded)
+
+		u.NoError(err, encoding)
+		u.Equal(body, decoded, encoding)
+	}
+}
+
+func (u *UnitTest) TestUnknownEncoding() {
+	_, err := compression.Encode("br", "fake-content")
+	u.EqualError(err, "unknown content encoding br")
+
+	_, err = compression.Decode("br", "fake-content")
+	u.EqualError(err, "unknown content encoding br")
+}
+
+func (u *UnitTest) TestCorruptedBody() {
+	_, err := compression.Decode(compression.Gzip, "not base64!")
+	u.ErrorContains(err, "failed to decode gzip body")
+
+	_, err = compression.Decode(compression.Zstd, "bm90IHpzdGQ=")
+	u.ErrorContains(err, "failed to decompress zstd body")
+}
@@ -0,0 +1,335 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer/message"
+)
+
+// maxBatchEntries is the maximum number of entries of the SQS batch actions
+const maxBatchEntries = 10
+
+// BatchResult is returned by HandleBatch to report the messages of the batch that were not handled
+type BatchResult struct {
+	// Failed holds the IDs of the messages that were not handled. They are backed off, and every other message of the batch is deleted.
+	Failed []string
+}
+
+// accumulateBatches groups the received messages into batches of up to BatchSize messages and passes them to flush.
+// When BatchWindow is zero, the messages of each ReceiveMessage call are flushed right away. Otherwise, a batch is flushed
+// when it is full or when BatchWindow has passed since it started. It returns the number of messages received.
+func (s *SQSClient) accumulateBatches(batches <-chan []*sqs.Message, flush func(batch []*sqs.Message)) int {
+	batchSize := s.ClientOptions.BatchSize
+	received := 0
+	pending := []*sqs.Message{}
+
+	var timeout <-chan time.Time
+
+	// flushFull flushes every full batch and reports whether it flushed any
+	flushFull := func() bool {
+		flushed := false
+
+		for len(pending) >= batchSize {
+			flush(pending[:batchSize:batchSize])
+			pending = pending[batchSize:]
+			flushed = true
+		}
+
+		return flushed
+	}
+
+	flushAll := func() {
+		flushFull()
+
+		if len(pending) > 0 {
+			flush(pending)
+		}
+
+		pending = []*sqs.Message{}
+		timeout = nil
+	}
+
+	for {
+		select {
+		case messages, ok := <-batches:
+			if !ok {
+				flushAll()
+
+				return received
+			}
+
+			received += len(messages)
+			pending = append(pending, messages...)
+
+			if s.ClientOptions.BatchWindow == 0 {
+				flushAll()
+
+				continue
+			}
+
+			if flushFull() {
+				timeout = nil
+			}
+
+			if len(pending) > 0 && timeout == nil {
+				timeout = time.After(s.ClientOptions.BatchWindow)
+			}
+		case <-timeout:
+			flushAll()
+		}
+	}
+}
+
+// safeProcessBatch processes the batch, logging processing errors and turning a panic in HandleBatch into an error
+func (s *SQSClient) safeProcessBatch(ctx context.Context, batch []*sqs.Message, queueUrl string, stats *handlerStats) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while handling batch: %v", r)
+		}
+	}()
+
+	start := time.Now()
+
+	handled, processErr := s.processBatch(ctx, batch, queueUrl)
+
+	if processErr != nil {
+		s.health.Failed(getQueueName(queueUrl), processErr)
+
+		s.Logger.Log("failed to process batch of %d messages: %s", len(batch), processErr.Error())
+	}
+
+	latency := time.Since(start)
+
+	for _, ok := range handled {
+		stats.record(latency, !ok)
+	}
+
+	return nil
+}
+
+// processBatch calls HandleBatch, then deletes the handled messages and backs off the failed ones.
+// Messages that can not be decoded are backed off, and invalid ones go through the poison action, without being passed to HandleBatch.
+// It returns whether each message was handled.
+func (s *SQSClient) processBatch(ctx context.Context, batch []*sqs.Message, queueUrl string) ([]bool, error) {
+	queueName := getQueueName(queueUrl)
+	messages := []*message.Message{}
+	failures := []*message.Message{}
+	invalid := 0
+	errs := []error{}
+	breaker := s.circuitBreaker(queueName)
+
+	// skip takes the messages that do not reach the handler out of the probe batch of the circuit breaker
+	skip := func(count int) {
+		for i := 0; breaker != nil && i < count; i++ {
+			breaker.skip()
+		}
+	}
+
+	for _, sqsMessage := range batch {
+		s.health.Acquire(queueName)
+		defer s.health.Release(queueName)
+
+		message, err := s.newMessage(ctx, sqsMessage)
+
+		if err != nil {
+			if s.rateLimiter != nil {
+				s.rateLimiter.release(queueName)
+			}
+
+			skip(1)
+
+			failures = append(failures, message)
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if valid, err := s.validateMessage(sqsMessage, message, queueUrl); !valid {
+			if s.rateLimiter != nil {
+				s.rateLimiter.release(queueName)
+			}
+
+			skip(1)
+
+			errs = append(errs, err)
+			invalid++
+
+			continue
+		}
+
+		messages = append(messages, message)
+	}
+
+	if s.rateLimiter != nil {
+		for i := range messages {
+			if err := s.rateLimiter.wait(ctx, queueName); err != nil {
+				for range messages[i+1:] {
+					s.rateLimiter.release(queueName)
+				}
+
+				skip(len(messages))
+
+				errs = append(errs, s.changeVisibility(queueUrl, messages, func(*message.Message) int64 {
+					return 0
+				}), s.backoffMessages(queueUrl, failures))
+
+				return make([]bool, len(batch)), errors.Join(errs...)
+			}
+		}
+	}
+
+	handled := make([]bool, len(failures), len(batch))
+
+	// Invalid messages are dealt with by the poison action, so they do not count as handler failures
+	for i := 0; i < invalid; i++ {
+		handled = append(handled, true)
+	}
+	succeeded := []*message.Message{}
+
+	if len(messages) > 0 {
+		result, ok := callHandler(ctx, s.ClientOptions.HandlerTimeout, func(ctx context.Context) BatchResult {
+			// Every message carries the context of the handler, like in Handle, e.g. for the middlewares calling message.Context
+			handling := make([]*message.Message, len(messages))
+
+			for i, message := range messages {
+				handling[i] = message.WithContext(ctx)
+			}
+
+			return s.ClientOptions.HandleBatch(ctx, handling)
+		})
+
+		if !ok {
+			s.Logger.Log("handling of batch of %d messages timed out after %s", len(messages), s.ClientOptions.HandlerTimeout)
+
+			for _, message := range messages {
+				result.Failed = append(result.Failed, message.Metadata.MessageId)
+			}
+		}
+
+		failed := make(map[string]bool, len(result.Failed))
+
+		for _, messageId := range result.Failed {
+			failed[messageId] = true
+		}
+
+		for _, message := range messages {
+			ok := !failed[message.Metadata.MessageId]
+
+			if breaker != nil {
+				breaker.record(!ok)
+			}
+
+			if ok {
+				succeeded = append(succeeded, message)
+			} else {
+				failures = append(failures, message)
+			}
+
+			handled = append(handled, ok)
+		}
+	}
+
+	errs = append(errs, s.deleteMessages(queueUrl, succeeded), s.backoffMessages(queueUrl, failures))
+
+	s.Logger.Log("batch of %d messages handled from queue %s, %d failed", len(batch), queueName, len(failures))
+
+	return handled, errors.Join(errs...)
+}
+
+// backoffMessages makes the messages that were not handled visible again after the backoff of their attempt
+func (s *SQSClient) backoffMessages(queueUrl string, messages []*message.Message) error {
+	return s.changeVisibility(queueUrl, messages, func(message *message.Message) int64 {
+		return int64(s.calculateBackoff(message.Metadata.ReceiveCount()))
+	})
+}
+
+// deleteMessages deletes the messages in batches of up to 10 messages
+func (s *SQSClient) deleteMessages(queueUrl string, messages []*message.Message) error {
+	errs := []error{}
+
+	for start := 0; start < len(messages); start += maxBatchEntries {
+		end := start + maxBatchEntries
+
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		entries := []*sqs.DeleteMessageBatchRequestEntry{}
+
+		for i, message := range messages[start:end] {
+			entries = append(entries, &sqs.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(strconv.Itoa(i)),
+				ReceiptHandle: aws.String(message.Metadata.ReceiptHandle),
+			})
+		}
+
+		result, err := s.Client.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(queueUrl),
+			Entries:  entries,
+		})
+
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		for _, entry := range result.Failed {
+			errs = append(errs, fmt.Errorf("failed to delete message: %s", aws.StringValue(entry.Message)))
+		}
+
+		for _, entry := range result.Successful {
+			if i, err := strconv.Atoi(aws.StringValue(entry.Id)); err == nil && i < end-start {
+				messages[start+i].Ack()
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// changeVisibility changes the visibility timeout of the messages in batches of up to 10 messages
+func (s *SQSClient) changeVisibility(queueUrl string, messages []*message.Message, visibilityTimeout func(message *message.Message) int64) error {
+	errs := []error{}
+
+	for start := 0; start < len(messages); start += maxBatchEntries {
+		end := start + maxBatchEntries
+
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		entries := []*sqs.ChangeMessageVisibilityBatchRequestEntry{}
+
+		for i, message := range messages[start:end] {
+			entries = append(entries, &sqs.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				ReceiptHandle:     aws.String(message.Metadata.ReceiptHandle),
+				VisibilityTimeout: aws.Int64(visibilityTimeout(message)),
+			})
+		}
+
+		result, err := s.Client.ChangeMessageVisibilityBatch(&sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String(queueUrl),
+			Entries:  entries,
+		})
+
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		for _, entry := range result.Failed {
+			errs = append(errs, fmt.Errorf("failed to change message visibility: %s", aws.StringValue(entry.Message)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,278 @@
+package consumer_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/stretchr/testify/mock"
+)
+
+// setupBatchMocks makes the first receives return the given number of messages each, and the next ones return no messages
+func (uts *UnitTest) setupBatchMocks(receives int, messages int) {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+
+	var calls int32
+
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(func(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+		call := int(atomic.AddInt32(&calls, 1))
+		output := &sqs.ReceiveMessageOutput{}
+
+		if call > receives {
+			return output, nil
+		}
+
+		for i := 0; i < messages; i++ {
+			output.Messages = append(output.Messages, &sqs.Message{
+				Body:          aws.String(`{"content": "fake-content"}`),
+				ReceiptHandle: aws.String(fmt.Sprintf("fake-receipt-handle-%d-%d", call, i)),
+				MessageId:     aws.String(fmt.Sprintf("fake-message-id-%d-%d", call, i)),
+				Attributes: map[string]*string{
+					"ApproximateReceiveCount": aws.String("1"),
+				},
+			})
+		}
+
+		return output, nil
+	}, nil)
+
+	uts.mockSQSService.On("DeleteMessageBatch", mock.Anything).Return(&sqs.DeleteMessageBatchOutput{}, nil)
+	uts.mockSQSService.On("ChangeMessageVisibilityBatch", mock.Anything).Return(&sqs.ChangeMessageVisibilityBatchOutput{}, nil)
+}
+
+func (uts *UnitTest) TestBatch_DeletesHandledAndBacksOffFailed() {
+	uts.setupBatchMocks(1, 3)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		HandleBatch: func(ctx context.Context, messages []*message.Message) consumer.BatchResult {
+			return consumer.BatchResult{Failed: []string{"fake-message-id-1-1"}}
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(700*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessageBatch", 1)
+	uts.mockSQSService.AssertCalled(uts.T(), "DeleteMessageBatch", mock.MatchedBy(func(input *sqs.DeleteMessageBatchInput) bool {
+		return len(input.Entries) == 2 &&
+			*input.Entries[0].ReceiptHandle == "fake-receipt-handle-1-0" &&
+			*input.Entries[1].ReceiptHandle == "fake-receipt-handle-1-2"
+	}))
+	uts.mockSQSService.AssertCalled(uts.T(), "ChangeMessageVisibilityBatch", mock.MatchedBy(func(input *sqs.ChangeMessageVisibilityBatchInput) bool {
+		return len(input.Entries) == 1 &&
+			*input.Entries[0].ReceiptHandle == "fake-receipt-handle-1-1" &&
+			*input.Entries[0].VisibilityTimeout > 0
+	}))
+	uts.mockSQSService.AssertNotCalled(uts.T(), "DeleteMessage", mock.Anything)
+}
+
+func (uts *UnitTest) TestBatch_Ack() {
+	uts.mockSQSService.On("DeleteMessageBatch", mock.Anything).Return(&sqs.DeleteMessageBatchOutput{
+		Successful: []*sqs.DeleteMessageBatchResultEntry{{Id: aws.String("0")}},
+		Failed:     []*sqs.BatchResultErrorEntry{{Id: aws.String("1"), Message: aws.String("fake-error")}},
+	}, nil)
+	uts.setupBatchMocks(1, 2)
+
+	var mu sync.Mutex
+
+	acked := []string{}
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		HandleBatch: func(ctx context.Context, messages []*message.Message) consumer.BatchResult {
+			for _, msg := range messages {
+				messageId := msg.Metadata.MessageId
+
+				msg.OnAck(func() {
+					mu.Lock()
+					defer mu.Unlock()
+
+					acked = append(acked, messageId)
+				})
+			}
+
+			return consumer.BatchResult{}
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(700*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Only the message deleted from the queue is acknowledged
+	uts.Equal([]string{"fake-message-id-1-0"}, acked)
+}
+
+func (uts *UnitTest) TestBatch_ContextIsNotCancelledOnStop() {
+	uts.setupBatchMocks(1, 1)
+
+	var cancelled atomic.Value
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		HandleBatch: func(ctx context.Context, messages []*message.Message) consumer.BatchResult {
+			// The consumer is stopped while the batch is handled
+			time.Sleep(300 * time.Millisecond)
+
+			cancelled.Store(ctx.Err() != nil)
+
+			return consumer.BatchResult{}
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(600*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Equal(false, cancelled.Load())
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessageBatch", 1)
+}
+
+func (uts *UnitTest) TestBatch_BatchSize() {
+	uts.setupBatchMocks(1, 3)
+
+	mu := sync.Mutex{}
+	sizes := []int{}
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		HandleBatch: func(ctx context.Context, messages []*message.Message) consumer.BatchResult {
+			mu.Lock()
+			defer mu.Unlock()
+
+			sizes = append(sizes, len(messages))
+
+			return consumer.BatchResult{}
+		},
+		BatchSize: 2,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(700*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.ElementsMatch([]int{2, 1}, sizes)
+}
+
+func (uts *UnitTest) TestBatch_BatchWindow() {
+	uts.setupBatchMocks(2, 3)
+
+	mu := sync.Mutex{}
+	sizes := []int{}
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		HandleBatch: func(ctx context.Context, messages []*message.Message) consumer.BatchResult {
+			mu.Lock()
+			defer mu.Unlock()
+
+			sizes = append(sizes, len(messages))
+
+			return consumer.BatchResult{}
+		},
+		BatchSize:   5,
+		BatchWindow: time.Second,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(1200*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	// The messages of both receives are accumulated into a full batch, and the remaining one is flushed when the client stops
+	uts.Equal([]int{5, 1}, sizes)
+}
+
+func (uts *UnitTest) TestBatch_HandlePanic() {
+	uts.setupBatchMocks(1, 1)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		HandleBatch: func(ctx context.Context, messages []*message.Message) consumer.BatchResult {
+			panic("fake-panic")
+		},
+	})
+
+	err := client.Run(context.Background())
+
+	uts.ErrorContains(err, "panic while handling batch: fake-panic")
+}
+
+func (uts *UnitTest) TestBatch_UndecodableMessagesAreBackedOff() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(&sqs.ReceiveMessageOutput{
+		Messages: []*sqs.Message{
+			{
+				Body:          aws.String(`{"content": "fake-content"}`),
+				ReceiptHandle: aws.String("fake-receipt-handle-1"),
+				MessageId:     aws.String("fake-message-id-1"),
+			},
+			{
+				Body:          aws.String("fake-content"),
+				ReceiptHandle: aws.String("fake-receipt-handle-2"),
+				MessageId:     aws.String("fake-message-id-2"),
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					"content-encoding": {DataType: aws.String("String"), StringValue: aws.String("br")},
+				},
+			},
+		},
+	}, nil).Once()
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(&sqs.ReceiveMessageOutput{}, nil)
+	uts.mockSQSService.On("DeleteMessageBatch", mock.Anything).Return(&sqs.DeleteMessageBatchOutput{}, nil)
+	uts.mockSQSService.On("ChangeMessageVisibilityBatch", mock.Anything).Return(&sqs.ChangeMessageVisibilityBatchOutput{}, nil)
+
+	mu := sync.Mutex{}
+	received := []string{}
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		HandleBatch: func(ctx context.Context, messages []*message.Message) consumer.BatchResult {
+			mu.Lock()
+			defer mu.Unlock()
+
+			for _, message := range messages {
+				received = append(received, message.Metadata.MessageId)
+			}
+
+			return consumer.BatchResult{}
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(700*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Equal([]string{"fake-message-id-1"}, received)
+	uts.mockSQSService.AssertCalled(uts.T(), "DeleteMessageBatch", mock.MatchedBy(func(input *sqs.DeleteMessageBatchInput) bool {
+		return len(input.Entries) == 1 && *input.Entries[0].ReceiptHandle == "fake-receipt-handle-1"
+	}))
+	uts.mockSQSService.AssertCalled(uts.T(), "ChangeMessageVisibilityBatch", mock.MatchedBy(func(input *sqs.ChangeMessageVisibilityBatchInput) bool {
+		return len(input.Entries) == 1 && *input.Entries[0].ReceiptHandle == "fake-receipt-handle-2"
+	}))
+}
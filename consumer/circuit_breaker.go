@@ -0,0 +1,279 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the ratio (between 0 and 1) of failed messages in the window that opens the circuit
+	FailureThreshold float64
+	// WindowSize is the number of most recently handled messages used to calculate the failure ratio
+	WindowSize int
+	// CoolDown is the time the circuit stays open (without receiving messages) before a probe batch is received
+	CoolDown time.Duration
+	// ProbeSize is the number of messages received while the circuit is half-open.
+	// The circuit closes when all of them are handled and opens again if any of them fails.
+	ProbeSize int64
+}
+
+const (
+	DefaultFailureThreshold = 0.5
+	DefaultWindowSize       = 20
+	DefaultCoolDown         = 30 * time.Second
+	DefaultProbeSize        = 1
+)
+
+func setDefaultCircuitBreakerOptions(options *CircuitBreakerOptions) {
+	if options.FailureThreshold == 0 {
+		options.FailureThreshold = DefaultFailureThreshold
+	}
+
+	if options.WindowSize == 0 {
+		options.WindowSize = DefaultWindowSize
+	}
+
+	if options.CoolDown == 0 {
+		options.CoolDown = DefaultCoolDown
+	}
+
+	if options.ProbeSize == 0 {
+		options.ProbeSize = DefaultProbeSize
+	}
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker stops receiving messages from a queue when the failure ratio of its handled messages crosses the threshold
+type circuitBreaker struct {
+	mu       sync.Mutex
+	options  CircuitBreakerOptions
+	queue    string
+	logger   Logger
+	state    circuitState
+	openedAt time.Time
+	// results is a ring buffer with the results of the last handled messages, true meaning failed
+	results  []bool
+	next     int
+	count    int
+	failures int
+	// probing is true when the probe batch was received, pending is the number of its messages not yet handled
+	// and passed the number of its messages handled successfully
+	probing bool
+	pending int64
+	passed  int64
+	// changed is closed and replaced whenever the state changes
+	changed chan struct{}
+}
+
+func newCircuitBreaker(queue string, options CircuitBreakerOptions, logger Logger) *circuitBreaker {
+	return &circuitBreaker{
+		options: options,
+		queue:   queue,
+		logger:  logger,
+		results: make([]bool, options.WindowSize),
+		changed: make(chan struct{}),
+	}
+}
+
+// acquire blocks until messages can be received, returning the maximum number of messages to receive (zero meaning no limit).
+// It returns false if the context is cancelled while waiting.
+func (b *circuitBreaker) acquire(ctx context.Context) (int64, bool) {
+	for {
+		b.mu.Lock()
+
+		var wait <-chan time.Time
+
+		switch b.state {
+		case circuitClosed:
+			b.mu.Unlock()
+
+			return 0, true
+		case circuitOpen:
+			remaining := time.Until(b.openedAt.Add(b.options.CoolDown))
+
+			if remaining <= 0 {
+				b.setState(circuitHalfOpen)
+				b.probing = true
+				b.mu.Unlock()
+
+				b.logger.Log("circuit half-open for queue %s, receiving probe batch", b.queue)
+
+				return b.options.ProbeSize, true
+			}
+
+			wait = time.After(remaining)
+		case circuitHalfOpen:
+			if !b.probing {
+				b.probing = true
+				b.mu.Unlock()
+
+				return b.options.ProbeSize, true
+			}
+		}
+
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return 0, false
+		case <-changed:
+		case <-wait:
+		}
+	}
+}
+
+// received records the number of messages received after acquire
+func (b *circuitBreaker) received(count int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != circuitHalfOpen {
+		return
+	}
+
+	if count == 0 {
+		// The queue is empty, so another probe batch can be received
+		b.probing = false
+
+		return
+	}
+
+	b.pending = int64(count)
+}
+
+// record records the result of a handled message, opening or closing the circuit when needed
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitClosed:
+		if b.results[b.next] {
+			b.failures--
+		}
+
+		b.results[b.next] = failed
+		b.next = (b.next + 1) % len(b.results)
+
+		if failed {
+			b.failures++
+		}
+
+		if b.count < len(b.results) {
+			b.count++
+		}
+
+		if b.count == len(b.results) && float64(b.failures)/float64(b.count) >= b.options.FailureThreshold {
+			b.open()
+		}
+	case circuitHalfOpen:
+		if !b.probing || b.pending == 0 {
+			return
+		}
+
+		if failed {
+			b.open()
+
+			return
+		}
+
+		b.pending--
+		b.passed++
+
+		b.probed()
+	}
+}
+
+// skip records a message that did not reach the handler, e.g. because it could not be decoded or was invalid.
+// It does not count in the failure ratio, but it is no longer pending in the probe batch.
+func (b *circuitBreaker) skip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != circuitHalfOpen || !b.probing || b.pending == 0 {
+		return
+	}
+
+	b.pending--
+
+	b.probed()
+}
+
+// probed closes the circuit when every message of the probe batch was handled, or receives another probe batch
+// when none of them reached the handler. It must be called with b.mu held.
+func (b *circuitBreaker) probed() {
+	if b.pending > 0 {
+		return
+	}
+
+	if b.passed == 0 {
+		b.probing = false
+
+		// Wake up the receivers waiting in acquire, so the next probe batch is received
+		b.setState(circuitHalfOpen)
+
+		return
+	}
+
+	b.reset()
+	b.setState(circuitClosed)
+
+	b.logger.Log("circuit closed for queue %s", b.queue)
+}
+
+func (b *circuitBreaker) open() {
+	b.reset()
+	b.openedAt = time.Now()
+	b.setState(circuitOpen)
+
+	b.logger.Log("circuit opened for queue %s, pausing for %s", b.queue, b.options.CoolDown.String())
+}
+
+func (b *circuitBreaker) reset() {
+	b.results = make([]bool, len(b.results))
+	b.next = 0
+	b.count = 0
+	b.failures = 0
+	b.probing = false
+	b.pending = 0
+	b.passed = 0
+}
+
+func (b *circuitBreaker) setState(state circuitState) {
+	b.state = state
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// circuitBreaker returns the circuit breaker of the queue, or nil when the circuit breaker is disabled
+func (s *SQSClient) circuitBreaker(queue string) *circuitBreaker {
+	if s.ClientOptions.CircuitBreaker == nil {
+		return nil
+	}
+
+	s.breakersMu.Lock()
+	defer s.breakersMu.Unlock()
+
+	if s.breakers == nil {
+		s.breakers = make(map[string]*circuitBreaker)
+	}
+
+	breaker, ok := s.breakers[queue]
+
+	if !ok {
+		breaker = newCircuitBreaker(queue, *s.ClientOptions.CircuitBreaker, s.Logger)
+		s.breakers[queue] = breaker
+	}
+
+	return breaker
+}
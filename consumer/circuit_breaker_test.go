@@ -0,0 +1,187 @@
+package consumer_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/stretchr/testify/mock"
+)
+
+func (uts *UnitTest) setupCircuitBreakerMocks() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(&sqs.ReceiveMessageOutput{
+		Messages: []*sqs.Message{
+			{
+				Body:          aws.String(`{"content": "fake-content"}`),
+				ReceiptHandle: aws.String("fake-receipt-handle"),
+				MessageId:     aws.String("fake-message-id"),
+			},
+		},
+	}, nil)
+
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+}
+
+func (uts *UnitTest) TestCircuitBreaker_Opens() {
+	uts.setupCircuitBreakerMocks()
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return false
+		},
+		CircuitBreaker: &consumer.CircuitBreakerOptions{
+			FailureThreshold: 1,
+			WindowSize:       1,
+			CoolDown:         time.Hour,
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1600*time.Millisecond)
+	defer cancel()
+
+	uts.NoError(client.Run(ctx))
+
+	// Without the circuit breaker, ReceiveMessage would be called 3 times
+	uts.LessOrEqual(len(callsTo(uts.mockSQSService.Calls, "ReceiveMessage")), 2)
+}
+
+func (uts *UnitTest) TestCircuitBreaker_HalfOpen() {
+	uts.setupCircuitBreakerMocks()
+
+	var attempts int32
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return atomic.AddInt32(&attempts, 1) > 1
+		},
+		CircuitBreaker: &consumer.CircuitBreakerOptions{
+			FailureThreshold: 1,
+			WindowSize:       1,
+			CoolDown:         100 * time.Millisecond,
+			ProbeSize:        1,
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1600*time.Millisecond)
+	defer cancel()
+
+	uts.NoError(client.Run(ctx))
+
+	uts.mockSQSService.AssertCalled(uts.T(), "ReceiveMessage", mock.MatchedBy(func(input *sqs.ReceiveMessageInput) bool {
+		return *input.MaxNumberOfMessages == 1
+	}))
+	uts.mockSQSService.AssertCalled(uts.T(), "ReceiveMessage", mock.MatchedBy(func(input *sqs.ReceiveMessageInput) bool {
+		return *input.MaxNumberOfMessages == 10
+	}))
+	uts.mockSQSService.AssertCalled(uts.T(), "DeleteMessage", mock.Anything)
+}
+
+func (uts *UnitTest) TestCircuitBreaker_StaysClosedBelowThreshold() {
+	uts.setupCircuitBreakerMocks()
+
+	var attempts int32
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return atomic.AddInt32(&attempts, 1)%2 == 0
+		},
+		CircuitBreaker: &consumer.CircuitBreakerOptions{
+			FailureThreshold: 0.9,
+			WindowSize:       2,
+			CoolDown:         time.Hour,
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1600*time.Millisecond)
+	defer cancel()
+
+	uts.NoError(client.Run(ctx))
+
+	uts.GreaterOrEqual(len(callsTo(uts.mockSQSService.Calls, "ReceiveMessage")), 3)
+}
+
+func (uts *UnitTest) TestCircuitBreaker_UndecodableProbe() {
+	newReceiveOutput := func(attributes map[string]*sqs.MessageAttributeValue) *sqs.ReceiveMessageOutput {
+		return &sqs.ReceiveMessageOutput{
+			Messages: []*sqs.Message{
+				{
+					Body:              aws.String(`{"content": "fake-content"}`),
+					ReceiptHandle:     aws.String("fake-receipt-handle"),
+					MessageId:         aws.String("fake-message-id"),
+					MessageAttributes: attributes,
+				},
+			},
+		}
+	}
+
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+
+	var probes int32
+
+	// The first probe can not be decoded, so another probe is received
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(func(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+		if *input.MaxNumberOfMessages == 1 && atomic.AddInt32(&probes, 1) == 1 {
+			return newReceiveOutput(map[string]*sqs.MessageAttributeValue{
+				"content-encoding": {DataType: aws.String("String"), StringValue: aws.String("br")},
+			}), nil
+		}
+
+		return newReceiveOutput(nil), nil
+	})
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	var attempts int32
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return atomic.AddInt32(&attempts, 1) > 1
+		},
+		CircuitBreaker: &consumer.CircuitBreakerOptions{
+			FailureThreshold: 1,
+			WindowSize:       1,
+			CoolDown:         100 * time.Millisecond,
+			ProbeSize:        1,
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2600*time.Millisecond)
+	defer cancel()
+
+	uts.NoError(client.Run(ctx))
+
+	// The circuit closed after the second probe
+	uts.Equal(int32(2), atomic.LoadInt32(&probes))
+	uts.mockSQSService.AssertCalled(uts.T(), "DeleteMessage", mock.Anything)
+
+	calls := callsTo(uts.mockSQSService.Calls, "ReceiveMessage")
+
+	uts.Equal(int64(10), *calls[len(calls)-1].Arguments.Get(0).(*sqs.ReceiveMessageInput).MaxNumberOfMessages)
+}
+
+func callsTo(calls []mock.Call, method string) []mock.Call {
+	matched := []mock.Call{}
+
+	for _, call := range calls {
+		if call.Method == method {
+			matched = append(matched, call)
+		}
+	}
+
+	return matched
+}
@@ -0,0 +1,345 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+type AdaptiveConcurrencyOptions struct {
+	// MinWorkers and MaxWorkers bound the number of messages handled concurrently per queue
+	MinWorkers int
+	MaxWorkers int
+	// MinReceivers and MaxReceivers bound the number of concurrent ReceiveMessage loops per queue
+	MinReceivers int
+	MaxReceivers int
+	// TargetLatency is the average handler latency above which the number of workers is reduced. It is ignored when zero.
+	TargetLatency time.Duration
+	// MaxErrorRate is the ratio (between 0 and 1) of failed messages above which the number of workers is reduced
+	MaxErrorRate float64
+	// Interval is the time between adjustments
+	Interval time.Duration
+}
+
+const (
+	DefaultMinWorkers   = 1
+	DefaultMaxWorkers   = 100
+	DefaultMinReceivers = 1
+	DefaultMaxReceivers = 5
+	DefaultMaxErrorRate = 0.5
+	DefaultInterval     = 10 * time.Second
+)
+
+// maxStaleIntervals is the number of intervals without handled messages during which the stats of the last one that had some are used
+const maxStaleIntervals = 3
+
+func setDefaultAdaptiveConcurrencyOptions(options *AdaptiveConcurrencyOptions) {
+	if options.MinWorkers == 0 {
+		options.MinWorkers = DefaultMinWorkers
+	}
+
+	if options.MaxWorkers == 0 {
+		options.MaxWorkers = DefaultMaxWorkers
+	}
+
+	if options.MinReceivers == 0 {
+		options.MinReceivers = DefaultMinReceivers
+	}
+
+	if options.MaxReceivers == 0 {
+		options.MaxReceivers = DefaultMaxReceivers
+	}
+
+	if options.MaxErrorRate == 0 {
+		options.MaxErrorRate = DefaultMaxErrorRate
+	}
+
+	if options.Interval == 0 {
+		options.Interval = DefaultInterval
+	}
+}
+
+// concurrencyLimiter limits the number of messages handled concurrently. A limit of zero means unlimited.
+type concurrencyLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+func newConcurrencyLimiter(limit int) *concurrencyLimiter {
+	limiter := &concurrencyLimiter{limit: limit}
+	limiter.cond = sync.NewCond(&limiter.mu)
+
+	return limiter
+}
+
+func (l *concurrencyLimiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.limit > 0 && l.active >= l.limit {
+		l.cond.Wait()
+	}
+
+	l.active++
+}
+
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.cond.Broadcast()
+}
+
+func (l *concurrencyLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = limit
+	l.cond.Broadcast()
+}
+
+func (l *concurrencyLimiter) usage() (limit int, active int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limit, l.active
+}
+
+// receiverGroup runs a resizable number of receive loops. Every loop has its own context, so it can be stopped individually.
+type receiverGroup struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	receive func(ctx context.Context)
+	cancels []context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func newReceiverGroup(ctx context.Context, receive func(ctx context.Context)) *receiverGroup {
+	return &receiverGroup{
+		ctx:     ctx,
+		receive: receive,
+	}
+}
+
+// scale starts or stops receive loops until there are n of them. A stopped loop finishes its current receive before returning:
+// its context is cancelled, but the receives are only aborted by the context of the group (see SQSClient.receiveMessages).
+func (g *receiverGroup) scale(n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for len(g.cancels) < n && g.ctx.Err() == nil {
+		ctx, cancel := context.WithCancel(g.ctx)
+
+		g.cancels = append(g.cancels, cancel)
+		g.wg.Add(1)
+
+		go func() {
+			defer g.wg.Done()
+
+			g.receive(ctx)
+		}()
+	}
+
+	for len(g.cancels) > n {
+		g.cancels[len(g.cancels)-1]()
+		g.cancels = g.cancels[:len(g.cancels)-1]
+	}
+}
+
+func (g *receiverGroup) size() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return len(g.cancels)
+}
+
+// wait blocks until every receive loop returned
+func (g *receiverGroup) wait() {
+	g.wg.Wait()
+}
+
+// handlerStats collects the latency and the result of the messages handled since the last reset
+type handlerStats struct {
+	mu       sync.Mutex
+	count    int
+	failures int
+	latency  time.Duration
+}
+
+func (h *handlerStats) record(latency time.Duration, failed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.count++
+	h.latency += latency
+
+	if failed {
+		h.failures++
+	}
+}
+
+// reset returns the average latency, the error rate and the number of messages handled, and starts collecting again
+func (h *handlerStats) reset() (time.Duration, float64, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := h.count
+
+	if count == 0 {
+		return 0, 0, 0
+	}
+
+	latency := h.latency / time.Duration(count)
+	errorRate := float64(h.failures) / float64(count)
+
+	h.count = 0
+	h.failures = 0
+	h.latency = 0
+
+	return latency, errorRate, count
+}
+
+// concurrencySample is the state of a queue used to adjust its concurrency
+type concurrencySample struct {
+	workers       int
+	activeWorkers int
+	receivers     int
+	latency       time.Duration
+	errorRate     float64
+	handled       int
+	// backlog is the approximate number of messages available in the queue, or -1 when unknown
+	backlog int64
+}
+
+// adjustConcurrency returns the number of workers and receivers for the next interval.
+// Workers are reduced when handlers are slow or failing, and increased when they are all busy and there is a backlog.
+// Receivers follow the backlog as long as the workers are able to handle more messages.
+func adjustConcurrency(options *AdaptiveConcurrencyOptions, maxNumberOfMessages int64, sample concurrencySample) (int, int) {
+	workers := sample.workers
+	receivers := sample.receivers
+	step := workers / 4
+
+	if step < 1 {
+		step = 1
+	}
+
+	overloaded := (options.TargetLatency > 0 && sample.latency > options.TargetLatency) ||
+		(sample.handled > 0 && sample.errorRate > options.MaxErrorRate)
+	saturated := sample.activeWorkers >= workers
+
+	switch {
+	case overloaded:
+		workers -= step
+	case sample.backlog > 0 && saturated:
+		workers += step
+	case sample.backlog == 0 && sample.activeWorkers < workers/2:
+		workers--
+	}
+
+	switch {
+	case sample.backlog < 0:
+	case overloaded:
+		receivers--
+	case !saturated && sample.backlog > int64(receivers)*maxNumberOfMessages:
+		receivers++
+	case sample.backlog < int64(receivers-1)*maxNumberOfMessages:
+		receivers--
+	}
+
+	return clamp(workers, options.MinWorkers, options.MaxWorkers), clamp(receivers, options.MinReceivers, options.MaxReceivers)
+}
+
+func clamp(value, lower, upper int) int {
+	if value < lower {
+		return lower
+	}
+
+	if value > upper {
+		return upper
+	}
+
+	return value
+}
+
+// getBacklog returns the approximate number of messages available in the queue
+func (s *SQSClient) getBacklog(queueUrl string) (int64, error) {
+	result, err := s.Client.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueUrl),
+		AttributeNames: []*string{aws.String(sqs.QueueAttributeNameApproximateNumberOfMessages)},
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(aws.StringValue(result.Attributes[sqs.QueueAttributeNameApproximateNumberOfMessages]), 10, 64)
+}
+
+// adaptConcurrency adjusts the workers and receivers of the queue on every interval until the context is cancelled
+func (s *SQSClient) adaptConcurrency(ctx context.Context, queueUrl string, workers *concurrencyLimiter, receivers *receiverGroup, stats *handlerStats) {
+	options := s.ClientOptions.AdaptiveConcurrency
+	queueName := getQueueName(queueUrl)
+
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+
+	// The stats of the last interval that handled messages are kept for a few intervals, so an interval spent waiting for messages
+	// does not hide that the handler is slow or failing, while handlers that stopped completing are not judged on old results forever
+	var lastLatency time.Duration
+	var lastErrorRate float64
+	var lastHandled int
+	var staleIntervals int
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		backlog, err := s.getBacklog(queueUrl)
+
+		if err != nil {
+			s.Logger.Log("failed to get the backlog of queue %s: %s", queueName, err.Error())
+
+			backlog = -1
+		}
+
+		limit, active := workers.usage()
+		latency, errorRate, handled := stats.reset()
+
+		if handled > 0 {
+			lastLatency, lastErrorRate, lastHandled = latency, errorRate, handled
+			staleIntervals = 0
+		} else if staleIntervals < maxStaleIntervals {
+			latency, errorRate, handled = lastLatency, lastErrorRate, lastHandled
+			staleIntervals++
+		}
+
+		nextWorkers, nextReceivers := adjustConcurrency(options, s.ClientOptions.MaxNumberOfMessages, concurrencySample{
+			workers:       limit,
+			activeWorkers: active,
+			receivers:     receivers.size(),
+			latency:       latency,
+			errorRate:     errorRate,
+			handled:       handled,
+			backlog:       backlog,
+		})
+
+		if nextWorkers != limit || nextReceivers != receivers.size() {
+			s.Logger.Log("adjusting concurrency of queue %s to %d workers and %d receivers", queueName, nextWorkers, nextReceivers)
+		}
+
+		workers.setLimit(nextWorkers)
+		receivers.scale(nextReceivers)
+
+		s.health.SetConcurrency(queueName, nextWorkers, nextReceivers)
+	}
+}
@@ -0,0 +1,313 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/inaciogu/go-sqs/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+func (uts *UnitTest) setupAdaptiveConcurrencyMocks(messages int, backlog string) {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+
+	uts.mockSQSService.On("GetQueueAttributes", mock.Anything).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]*string{
+			"ApproximateNumberOfMessages": aws.String(backlog),
+		},
+	}, nil)
+
+	output := &sqs.ReceiveMessageOutput{}
+
+	for i := 0; i < messages; i++ {
+		output.Messages = append(output.Messages, &sqs.Message{
+			Body:          aws.String(`{"content": "fake-content"}`),
+			ReceiptHandle: aws.String(fmt.Sprintf("fake-receipt-handle-%d", i)),
+			MessageId:     aws.String(fmt.Sprintf("fake-message-id-%d", i)),
+		})
+	}
+
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(output, nil)
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+}
+
+func (uts *UnitTest) TestAdaptiveConcurrency_ScalesReceiversWithBacklog() {
+	uts.setupAdaptiveConcurrencyMocks(0, "1000")
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		AdaptiveConcurrency: &consumer.AdaptiveConcurrencyOptions{
+			MaxReceivers: 3,
+			Interval:     50 * time.Millisecond,
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(700*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	status := client.Health()[0]
+
+	uts.Equal(3, status.Receivers)
+	uts.GreaterOrEqual(len(callsTo(uts.mockSQSService.Calls, "ReceiveMessage")), 3)
+}
+
+func (uts *UnitTest) TestAdaptiveConcurrency_ScalesWorkersWhenSaturated() {
+	uts.setupAdaptiveConcurrencyMocks(10, "1000")
+
+	var active, maxActive int32
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			current := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+
+			for {
+				previous := atomic.LoadInt32(&maxActive)
+
+				if current <= previous || atomic.CompareAndSwapInt32(&maxActive, previous, current) {
+					break
+				}
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			return true
+		},
+		AdaptiveConcurrency: &consumer.AdaptiveConcurrencyOptions{
+			MaxWorkers:   4,
+			MaxReceivers: 1,
+			Interval:     50 * time.Millisecond,
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(1500*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Equal(4, client.Health()[0].Workers)
+	uts.Greater(atomic.LoadInt32(&maxActive), int32(1))
+	uts.LessOrEqual(atomic.LoadInt32(&maxActive), int32(4))
+}
+
+func (uts *UnitTest) TestAdaptiveConcurrency_BacksOffWhenFailing() {
+	uts.setupAdaptiveConcurrencyMocks(10, "1000")
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			time.Sleep(20 * time.Millisecond)
+
+			return false
+		},
+		AdaptiveConcurrency: &consumer.AdaptiveConcurrencyOptions{
+			MaxWorkers:   4,
+			MaxReceivers: 3,
+			Interval:     50 * time.Millisecond,
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(1500*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	status := client.Health()[0]
+
+	uts.Equal(1, status.Workers)
+	uts.Equal(1, status.Receivers)
+}
+
+func (uts *UnitTest) TestReceivers() {
+	uts.setupAdaptiveConcurrencyMocks(0, "0")
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Receivers: 3,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	// Every receiver finishes its long poll before Run returns
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "ReceiveMessage", 3)
+}
+
+func (uts *UnitTest) TestReceivers_StopTogetherOnError() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+
+	var calls int32
+
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(func(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, errors.New("receive error")
+		}
+
+		return &sqs.ReceiveMessageOutput{}, nil
+	})
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Receivers: 3,
+	})
+
+	uts.EqualError(client.Run(context.Background()), "receive error")
+}
+
+func (uts *UnitTest) TestWorkers() {
+	uts.setupAdaptiveConcurrencyMocks(10, "0")
+
+	var active, maxActive int32
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			current := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+
+			for {
+				previous := atomic.LoadInt32(&maxActive)
+
+				if current <= previous || atomic.CompareAndSwapInt32(&maxActive, previous, current) {
+					break
+				}
+			}
+
+			time.Sleep(50 * time.Millisecond)
+
+			return true
+		},
+		Receivers: 2,
+		Workers:   3,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Equal(int32(3), atomic.LoadInt32(&maxActive))
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessage", 20)
+}
+
+func (uts *UnitTest) TestAdaptiveConcurrency_ExpiresStats() {
+	uts.setupAdaptiveConcurrencyMocks(10, "1000")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var handled int32
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			// The first messages fail, then the handlers are busy until the consumer stops, so no stats are collected anymore
+			if atomic.AddInt32(&handled, 1) <= 10 {
+				return false
+			}
+
+			<-ctx.Done()
+
+			return true
+		},
+		AdaptiveConcurrency: &consumer.AdaptiveConcurrencyOptions{
+			MaxWorkers:   4,
+			MaxReceivers: 1,
+			Interval:     50 * time.Millisecond,
+		},
+	})
+
+	time.AfterFunc(1500*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Equal(4, client.Health()[0].Workers)
+}
+
+// longPollService long polls for 200ms with the context of the receive, counting the polls aborted before the consumer stops
+type longPollService struct {
+	*mocks.SQSService
+	stopping int32
+	aborted  int32
+}
+
+func (l *longPollService) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	select {
+	case <-time.After(200 * time.Millisecond):
+		return &sqs.ReceiveMessageOutput{}, nil
+	case <-ctx.Done():
+		if atomic.LoadInt32(&l.stopping) == 0 {
+			atomic.AddInt32(&l.aborted, 1)
+		}
+
+		return nil, ctx.Err()
+	}
+}
+
+func (uts *UnitTest) TestAdaptiveConcurrency_ScaleDownFinishesReceives() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+
+	started := time.Now()
+
+	// The backlog makes the receivers scale up, then down once it is gone
+	uts.mockSQSService.On("GetQueueAttributes", mock.Anything).Return(func(input *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error) {
+		backlog := "1000"
+
+		if time.Since(started) > 400*time.Millisecond {
+			backlog = "0"
+		}
+
+		return &sqs.GetQueueAttributesOutput{
+			Attributes: map[string]*string{"ApproximateNumberOfMessages": aws.String(backlog)},
+		}, nil
+	}, nil)
+
+	service := &longPollService{SQSService: uts.mockSQSService}
+
+	client := consumer.New(service, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+		AdaptiveConcurrency: &consumer.AdaptiveConcurrencyOptions{
+			MaxReceivers: 3,
+			Interval:     50 * time.Millisecond,
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(1200*time.Millisecond, func() {
+		atomic.StoreInt32(&service.stopping, 1)
+		cancel()
+	})
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Equal(1, client.Health()[0].Receivers)
+	uts.Equal(int32(0), atomic.LoadInt32(&service.aborted))
+}
@@ -1,16 +1,24 @@
 package consumer
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
-	"strconv"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/codec"
+	"github.com/inaciogu/go-sqs/consumer/health"
 	"github.com/inaciogu/go-sqs/consumer/logger"
 	"github.com/inaciogu/go-sqs/consumer/message"
+	"golang.org/x/time/rate"
 )
 
 type SQSService interface {
@@ -19,6 +27,16 @@ type SQSService interface {
 	ChangeMessageVisibility(input *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error)
 	DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error)
 	ListQueues(input *sqs.ListQueuesInput) (*sqs.ListQueuesOutput, error)
+	GetQueueAttributes(input *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error)
+	DeleteMessageBatch(input *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error)
+	ChangeMessageVisibilityBatch(input *sqs.ChangeMessageVisibilityBatchInput) (*sqs.ChangeMessageVisibilityBatchOutput, error)
+	SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error)
+}
+
+// ContextReceiver is implemented by the services whose receives can be cancelled, e.g. *sqs.SQS and sqsv2.Service.
+// The consumer uses it to abort the long polls when it stops.
+type ContextReceiver interface {
+	ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error)
 }
 
 type Logger interface {
@@ -26,21 +44,51 @@ type Logger interface {
 }
 
 type SQSClientInterface interface {
+	// GetQueueName returns the configured queue name (or prefix), which identifies the client
+	GetQueueName() string
 	GetQueueUrl() *string
 	ReceiveMessages(queueUrl string, ch chan *sqs.Message) error
 	ProcessMessage(message *sqs.Message, queueUrl string)
 	Poll()
 	GetQueues(prefix string) []*string
 	Start()
+	// Run consumes messages until the context is cancelled, returning the error that stopped the client, if any
+	Run(ctx context.Context) error
 }
 
 type SQSClientOptions struct {
+	// QueueName is the name, URL or ARN of the queue. The region of a URL or ARN takes precedence over Region
+	// when no SQSService is passed to New, so queues of other regions and accounts can be consumed.
 	QueueName string
+	// QueueOwnerAWSAccountId is the account that owns the queue when it is configured by name and belongs to another account
+	QueueOwnerAWSAccountId string
 	// Handle is the function that will be called when a message is received.
 	// Return true if you want to delete the message from the queue, otherwise, return false
-	Handle   func(message *message.Message) bool
-	Region   string
+	Handle func(message *message.Message) bool
+	// HandlerTimeout is the maximum time Handle or HandleBatch may take. When it is exceeded, the context of the handler
+	// (see message.Context) is cancelled and the messages are backed off as failed, without waiting for the handler to return.
+	// Zero means no timeout.
+	HandlerTimeout time.Duration
+	// HandleBatch is an alternative to Handle that receives several messages at once.
+	// The handled messages are deleted in batches and the ones reported as failed are backed off.
+	HandleBatch func(ctx context.Context, messages []*message.Message) BatchResult
+	// BatchSize is the maximum number of messages passed to HandleBatch. Defaults to MaxNumberOfMessages.
+	BatchSize int
+	// BatchWindow is the maximum time messages are accumulated before calling HandleBatch.
+	// When zero, HandleBatch is called with the messages of each ReceiveMessage call.
+	BatchWindow time.Duration
+	// Region is the region of the queues. Defaults to the region of the shared config, then to DefaultRegion.
+	Region string
+	// Endpoint overrides the endpoint of SQS, e.g. for LocalStack
 	Endpoint string
+	// Profile is the shared config profile used when no SQSService is passed to New. Defaults to AWS_PROFILE, then to "default".
+	Profile string
+	// Credentials replaces the default credential chain of the SDK when no SQSService is passed to New
+	Credentials *credentials.Credentials
+	// AssumeRole assumes a role with the resolved credentials when no SQSService is passed to New, e.g. to consume queues of another account
+	AssumeRole *AssumeRoleOptions
+	// HTTPClient is the HTTP client used when no SQSService is passed to New, e.g. to set proxies or timeouts
+	HTTPClient *http.Client
 	// PrefixBased is a flag that indicates if the queue name is a prefix
 	PrefixBased         bool
 	MaxNumberOfMessages int64
@@ -49,12 +97,51 @@ type SQSClientOptions struct {
 	LogLevel            string
 	// BackoffMultiplier is the multiplier used to calculate the backoff time (visibility timeout)
 	BackoffMultiplier float64
+	// RateLimit limits the number of messages processed per second by the client. It is disabled when nil.
+	RateLimit *RateLimit
+	// SharedRateLimiter is a limiter (see NewRateLimiter) shared by several clients to limit the messages processed per second globally
+	SharedRateLimiter *rate.Limiter
+	// Receivers is the number of concurrent ReceiveMessage loops per queue. Defaults to 1.
+	Receivers int
+	// Workers is the maximum number of messages handled concurrently per queue, shared by all its receivers. Zero means unlimited.
+	Workers int
+	// AdaptiveConcurrency adjusts the number of concurrent handlers and receivers of each queue based on the handler latency,
+	// the error rate and the queue backlog. When set, Receivers and Workers are ignored.
+	AdaptiveConcurrency *AdaptiveConcurrencyOptions
+	// CircuitBreaker stops receiving messages from a queue when the failure ratio of its messages crosses a threshold. It is disabled when nil.
+	CircuitBreaker *CircuitBreakerOptions
+	// Source tells how the bodies of the messages are delivered: SNS notifications are unwrapped when detected (auto), never (raw)
+	// or always (sns), in which case the messages that are not SNS notifications are rejected. Defaults to auto.
+	Source message.SourceMode
+	// Codec decodes the messages without a content-type attribute in message.Unmarshal. Defaults to JSON.
+	Codec codec.Codec
+	// Encryption decrypts the messages encrypted by the producer before they are handled. It is disabled when nil.
+	Encryption *EncryptionOptions
+	// Validation validates the content of the messages against JSON Schemas before they are handled. It is disabled when nil.
+	Validation *ValidationOptions
+	// PayloadResolver replaces the references to payloads stored outside of SQS by the payloads, before the messages are validated
+	// and handled, e.g. largepayload.NewResolver. It is disabled when nil.
+	PayloadResolver PayloadResolver
+	// SNSVerification verifies the signature of the SNS notifications before they are handled. It is disabled when nil.
+	SNSVerification *SNSVerificationOptions
+}
+
+// PayloadResolver replaces the content of the messages that carry a reference to their payload by the payload
+type PayloadResolver interface {
+	// Resolve replaces the content of the message when it carries a reference, leaving the other messages as they are
+	Resolve(ctx context.Context, message *message.Message) error
 }
 
 type SQSClient struct {
 	Client        SQSService
 	ClientOptions *SQSClientOptions
 	Logger        Logger
+	health        *health.Tracker
+	paused        pauseSet
+	breakersMu    sync.Mutex
+	breakers      map[string]*circuitBreaker
+	rateLimiter   *rateLimiter
+	validator     *validator
 }
 
 const (
@@ -69,25 +156,59 @@ func New(sqsService SQSService, options SQSClientOptions) *SQSClient {
 		panic("QueueName is required")
 	}
 
+	switch options.Source {
+	case "", message.SourceAuto, message.SourceRaw, message.SourceSNS:
+	default:
+		panic(fmt.Sprintf("unknown Source %s", options.Source))
+	}
+
+	if options.Encryption != nil && options.Encryption.Provider == nil {
+		panic("Encryption requires a Provider")
+	}
+
+	// A limit of zero never grants a token, which would make the receive loop spin
+	if options.RateLimit != nil && options.RateLimit.MessagesPerSecond <= 0 {
+		panic("RateLimit requires a positive MessagesPerSecond")
+	}
+
+	queue, err := parseQueue(options.QueueName)
+
+	if err != nil {
+		panic(err)
+	}
+
+	if options.PrefixBased && queue.Name != options.QueueName {
+		panic("PrefixBased requires a queue name, not a URL or ARN")
+	}
+
 	if sqsService == nil {
-		sess := session.Must(session.NewSessionWithOptions(session.Options{
-			Config: aws.Config{
-				Credentials: credentials.NewCredentials(&credentials.EnvProvider{}),
-				Region:      aws.String(options.Region),
-				Endpoint:    aws.String(options.Endpoint),
-			},
-		}))
-		sqsService = sqs.New(sess)
+		if queue.Region != "" {
+			options.Region = queue.Region
+		}
+
+		service, err := newSQSService(options)
+
+		if err != nil {
+			panic(err)
+		}
+
+		sqsService = service
 	}
 
 	setDefaultOptions(&options)
 
 	logger := logger.New(logger.DefaultLoggerConfig{LogLevel: options.LogLevel})
-	return &SQSClient{
+	client := &SQSClient{
 		Client:        sqsService,
 		ClientOptions: &options,
 		Logger:        logger,
+		health:        health.NewTracker(),
 	}
+
+	client.setRateLimiter()
+	client.setValidator()
+
+	return client
 }
 
 func setDefaultOptions(options *SQSClientOptions) {
@@ -111,30 +232,136 @@ func setDefaultOptions(options *SQSClientOptions) {
 		options.LogLevel = "info"
 	}
 
+	if options.Source == "" {
+		options.Source = message.SourceAuto
+	}
+
 	if options.BackoffMultiplier == 0 {
 		options.BackoffMultiplier = 2
 	}
+
+	if options.Receivers == 0 {
+		options.Receivers = 1
+	}
+
+	if options.BatchSize == 0 {
+		options.BatchSize = int(options.MaxNumberOfMessages)
+	}
+
+	if options.CircuitBreaker != nil {
+		circuitBreakerOptions := *options.CircuitBreaker
+
+		setDefaultCircuitBreakerOptions(&circuitBreakerOptions)
+
+		options.CircuitBreaker = &circuitBreakerOptions
+	}
+
+	if options.AdaptiveConcurrency != nil {
+		adaptiveConcurrencyOptions := *options.AdaptiveConcurrency
+
+		setDefaultAdaptiveConcurrencyOptions(&adaptiveConcurrencyOptions)
+
+		options.AdaptiveConcurrency = &adaptiveConcurrencyOptions
+	}
+
+	if options.Validation != nil {
+		validationOptions := *options.Validation
+
+		setDefaultValidationOptions(&validationOptions, options.VisibilityTimeout)
+
+		options.Validation = &validationOptions
+	}
+
+	if options.SNSVerification != nil {
+		snsVerificationOptions := *options.SNSVerification
+
+		setDefaultSNSVerificationOptions(&snsVerificationOptions)
+
+		options.SNSVerification = &snsVerificationOptions
+	}
 }
 
 func (s *SQSClient) SetLogger(logger Logger) {
 	s.Logger = logger
 }
 
-// GetQueueUrl returns the URL of the queue based on the queue name
+// Health returns the health status of every queue consumed by the client
+func (s *SQSClient) Health() []health.QueueStatus {
+	return s.health.Statuses()
+}
+
+// getQueueName returns the queue name based on the queue URL
+func getQueueName(queueUrl string) string {
+	splittedUrl := strings.Split(queueUrl, "/")
+
+	return splittedUrl[len(splittedUrl)-1]
+}
+
+// GetQueueName returns the configured queue name, URL or ARN (or prefix when PrefixBased is true)
+func (s *SQSClient) GetQueueName() string {
+	return s.ClientOptions.QueueName
+}
+
+// GetQueueUrl returns the URL of the queue, resolving it by name or ARN unless QueueName is a URL
 func (s *SQSClient) GetQueueUrl() *string {
-	urlResult, err := s.Client.GetQueueUrl(&sqs.GetQueueUrlInput{
-		QueueName: aws.String(s.ClientOptions.QueueName),
-	})
+	queueUrl, err := s.getQueueUrl()
 
 	if err != nil {
 		panic(err)
 	}
 
-	return aws.String(*urlResult.QueueUrl)
+	return queueUrl
+}
+
+func (s *SQSClient) getQueueUrl() (*string, error) {
+	queue, err := parseQueue(s.ClientOptions.QueueName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// A URL is used as is, without resolving it
+	if queue.Url != "" {
+		s.health.Discovered(queue.Name)
+
+		return aws.String(queue.Url), nil
+	}
+
+	input := &sqs.GetQueueUrlInput{
+		QueueName: aws.String(queue.Name),
+	}
+
+	if queue.AccountId != "" {
+		input.QueueOwnerAWSAccountId = aws.String(queue.AccountId)
+	} else if s.ClientOptions.QueueOwnerAWSAccountId != "" {
+		input.QueueOwnerAWSAccountId = aws.String(s.ClientOptions.QueueOwnerAWSAccountId)
+	}
+
+	urlResult, err := s.Client.GetQueueUrl(input)
+
+	if err != nil {
+		s.health.DiscoveryFailed(queue.Name, err)
+
+		return nil, err
+	}
+
+	s.health.Discovered(queue.Name)
+
+	return aws.String(*urlResult.QueueUrl), nil
 }
 
 // GetQueues returns a list of queues based on the prefix
 func (s *SQSClient) GetQueues(prefix string) []*string {
+	queueUrls, err := s.getQueues(prefix)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return queueUrls
+}
+
+func (s *SQSClient) getQueues(prefix string) ([]*string, error) {
 	input := &sqs.ListQueuesInput{
 		QueueNamePrefix: aws.String(prefix),
 	}
@@ -142,39 +369,140 @@ func (s *SQSClient) GetQueues(prefix string) []*string {
 	result, err := s.Client.ListQueues(input)
 
 	if err != nil {
-		panic(err)
+		s.health.DiscoveryFailed(prefix, err)
+
+		return nil, err
+	}
+
+	matchesPrefix := false
+
+	for _, queueUrl := range result.QueueUrls {
+		queueName := getQueueName(*queueUrl)
+
+		s.health.Discovered(queueName)
+
+		if queueName == prefix {
+			matchesPrefix = true
+		}
 	}
 
-	return result.QueueUrls
+	// A failed discovery is recorded under the prefix, which is not tracked anymore unless it is also the name of a queue
+	if !matchesPrefix {
+		s.health.Remove(prefix)
+	}
+
+	return result.QueueUrls, nil
 }
 
 // ReceiveMessages polls messages from the queue
 func (s *SQSClient) ReceiveMessages(queueUrl string, ch chan *sqs.Message) error {
-	splittedUrl := strings.Split(queueUrl, "/")
+	err := s.receiveMessages(context.Background(), context.Background(), queueUrl, func(messages []*sqs.Message) {
+		for _, message := range messages {
+			ch <- message
+		}
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	return nil
+}
+
+// receiveMessages polls messages from the queue until the loop context is cancelled or a receive fails.
+// The loop context is derived from ctx, and can also be cancelled to stop the loop alone, e.g. when the receivers are scaled down:
+// only ctx aborts the receive in progress, so the messages it gets from SQS are not left invisible.
+// Every non-empty batch of received messages is passed to deliver, including the ones received before the cancellation.
+func (s *SQSClient) receiveMessages(ctx context.Context, loop context.Context, queueUrl string, deliver func(messages []*sqs.Message)) error {
+	queueName := getQueueName(queueUrl)
+
+	for loop.Err() == nil {
+		if s.paused.isPaused(queueName) {
+			s.paused.wait(loop, queueName)
+
+			continue
+		}
+
+		maxNumberOfMessages := s.ClientOptions.MaxNumberOfMessages
 
-	queueName := splittedUrl[len(splittedUrl)-1]
+		breaker := s.circuitBreaker(queueName)
+
+		if breaker != nil {
+			limit, ok := breaker.acquire(loop)
+
+			if !ok {
+				break
+			}
+
+			if limit > 0 && limit < maxNumberOfMessages {
+				maxNumberOfMessages = limit
+			}
+		}
+
+		if s.rateLimiter != nil {
+			if !s.rateLimiter.waitReceive(loop, queueName) {
+				break
+			}
+
+			if limit := s.rateLimiter.batchSize(s.ClientOptions.VisibilityTimeout); limit < maxNumberOfMessages {
+				maxNumberOfMessages = limit
+			}
+		}
 
-	for {
 		s.Logger.Log("polling messages from queue %s", queueName)
 
-		result, err := s.Client.ReceiveMessage(&sqs.ReceiveMessageInput{
+		result, err := s.receiveMessage(ctx, &sqs.ReceiveMessageInput{
 			QueueUrl:            aws.String(queueUrl),
-			MaxNumberOfMessages: aws.Int64(s.ClientOptions.MaxNumberOfMessages),
+			MaxNumberOfMessages: aws.Int64(maxNumberOfMessages),
 			WaitTimeSeconds:     aws.Int64(s.ClientOptions.WaitTimeSeconds),
 			VisibilityTimeout:   aws.Int64(s.ClientOptions.VisibilityTimeout),
 			AttributeNames:      []*string{aws.String("All")},
+			// The message attributes (content-encoding, content-type, encryption) are only returned when requested
+			MessageAttributeNames: []*string{aws.String("All")},
 		})
 
 		if err != nil {
-			panic(err)
+			if breaker != nil {
+				breaker.received(0)
+			}
+
+			// The long poll was aborted because the consumer is stopping
+			if ctx.Err() != nil {
+				break
+			}
+
+			s.health.Failed(queueName, err)
+
+			return err
+		}
+
+		s.health.Received(queueName)
+
+		if breaker != nil {
+			breaker.received(len(result.Messages))
+		}
+
+		if s.rateLimiter != nil {
+			s.rateLimiter.received(queueName, len(result.Messages))
 		}
 
 		s.Logger.Log("received %d messages from queue %s", len(result.Messages), queueName)
 
-		for _, message := range result.Messages {
-			ch <- message
+		if len(result.Messages) > 0 {
+			deliver(result.Messages)
 		}
 	}
+
+	return nil
+}
+
+// receiveMessage receives messages with the context when the service supports it, so the long poll is cancelled when the consumer stops
+func (s *SQSClient) receiveMessage(ctx context.Context, input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	if client, ok := s.Client.(ContextReceiver); ok {
+		return client.ReceiveMessageWithContext(ctx, input)
+	}
+
+	return s.Client.ReceiveMessage(input)
 }
 
 // calculateBackoff calculates the backoff (visibility timeout) time based on the number of attempts to process the message
@@ -184,71 +512,364 @@ func (s *SQSClient) calculateBackoff(attempts int) float64 {
 
 // ProcessMessage deletes or changes the visibility of the message based on the Handle function return.
 func (s *SQSClient) ProcessMessage(sqsMessage *sqs.Message, queueUrl string) {
-	message := message.New(sqsMessage)
+	if _, err := s.processMessage(context.Background(), sqsMessage, queueUrl); err != nil {
+		panic(err)
+	}
+}
 
-	handled := s.ClientOptions.Handle(message)
+// newMessage converts the received message, applying the options of the client.
+// It returns an error, along with the message as received, when its content can not be decoded or resolved, or its SNS signature is invalid.
+func (s *SQSClient) newMessage(ctx context.Context, sqsMessage *sqs.Message) (*message.Message, error) {
+	message, err := message.ParseWithSource(sqsMessage, s.ClientOptions.Source)
+	message.Codec = s.ClientOptions.Codec
 
-	if !handled {
-		attempts, _ := strconv.Atoi(message.Metadata.MessageAttributes["ApproximateReceiveCount"])
+	if err != nil {
+		return message, err
+	}
 
-		backoff := s.calculateBackoff(attempts)
+	if err := s.verifySignature(ctx, message); err != nil {
+		return message, err
+	}
 
-		_, err := s.Client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
-			QueueUrl:          aws.String(queueUrl),
-			ReceiptHandle:     &message.Metadata.ReceiptHandle,
-			VisibilityTimeout: aws.Int64(int64(backoff)),
-		})
+	if err := s.decrypt(ctx, message); err != nil {
+		return message, err
+	}
 
-		if err != nil {
-			panic(err)
+	if s.ClientOptions.PayloadResolver == nil {
+		return message, nil
+	}
+
+	return message, s.ClientOptions.PayloadResolver.Resolve(ctx, message)
+}
+
+// PrepareMessage converts a received message like the client does before calling Handle, so other runtimes (see the lambda package)
+// handle the same messages: the content is unwrapped and decoded, the SNS signature verified, and the content decrypted, resolved and validated.
+// Invalid messages are dealt with by the poison action of the Validation option, and valid is false.
+func (s *SQSClient) PrepareMessage(ctx context.Context, sqsMessage *sqs.Message, queueUrl string) (msg *message.Message, valid bool, err error) {
+	msg, err = s.newMessage(ctx, sqsMessage)
+
+	if err != nil {
+		return msg, false, err
+	}
+
+	valid, err = s.validateMessage(sqsMessage, msg, queueUrl)
+
+	return msg, valid, err
+}
+
+// processMessage processes the message, returning whether it was handled
+func (s *SQSClient) processMessage(ctx context.Context, sqsMessage *sqs.Message, queueUrl string) (bool, error) {
+	queueName := getQueueName(queueUrl)
+
+	s.health.Acquire(queueName)
+	defer s.health.Release(queueName)
+
+	breaker := s.circuitBreaker(queueName)
+	message, err := s.newMessage(ctx, sqsMessage)
+
+	// A message that can not be decoded is backed off like an unhandled one, so it eventually reaches the dead-letter queue
+	if err != nil {
+		if s.rateLimiter != nil {
+			s.rateLimiter.release(queueName)
+		}
+
+		if breaker != nil {
+			breaker.skip()
+		}
+
+		return false, errors.Join(err, s.backoffMessage(message, queueUrl))
+	}
+
+	// Invalid messages are dealt with by the poison action, so they do not count as handler failures
+	if valid, err := s.validateMessage(sqsMessage, message, queueUrl); !valid {
+		if s.rateLimiter != nil {
+			s.rateLimiter.release(queueName)
+		}
+
+		if breaker != nil {
+			breaker.skip()
+		}
+
+		return true, err
+	}
+
+	if s.rateLimiter != nil {
+		if err := s.rateLimiter.wait(ctx, queueName); err != nil {
+			if breaker != nil {
+				breaker.skip()
+			}
+
+			return false, s.releaseMessage(message, queueUrl)
+		}
+	}
+
+	handled, ok := callHandler(ctx, s.ClientOptions.HandlerTimeout, func(ctx context.Context) bool {
+		return s.ClientOptions.Handle(message.WithContext(ctx))
+	})
+
+	if !ok {
+		s.Logger.Log("handling of message %s timed out after %s", message.Metadata.MessageId, s.ClientOptions.HandlerTimeout)
+	}
+
+	if breaker != nil {
+		breaker.record(!handled)
+	}
+
+	if !handled {
+		if err := s.backoffMessage(message, queueUrl); err != nil {
+			return false, err
 		}
 
 		s.Logger.Log("failed to handle message with ID: %s", message.Metadata.MessageId)
 
-		return
+		return false, nil
 	}
 
-	_, err := s.Client.DeleteMessage(&sqs.DeleteMessageInput{
+	_, err = s.Client.DeleteMessage(&sqs.DeleteMessageInput{
 		QueueUrl:      aws.String(queueUrl),
 		ReceiptHandle: &message.Metadata.ReceiptHandle,
 	})
 
 	if err != nil {
-		panic(err)
+		return true, err
 	}
 
+	message.Ack()
+
 	s.Logger.Log("message handled ID: %s", message.Metadata.MessageId)
+
+	return true, nil
+}
+
+// backoffMessage makes a message that was not handled visible again after the backoff of its attempt
+func (s *SQSClient) backoffMessage(message *message.Message, queueUrl string) error {
+	backoff := s.calculateBackoff(message.Metadata.ReceiveCount())
+
+	_, err := s.Client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(queueUrl),
+		ReceiptHandle:     &message.Metadata.ReceiptHandle,
+		VisibilityTimeout: aws.Int64(int64(backoff)),
+	})
+
+	return err
+}
+
+// releaseMessage makes a message that will not be handled visible again, so it can be received right away
+func (s *SQSClient) releaseMessage(message *message.Message, queueUrl string) error {
+	_, err := s.Client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(queueUrl),
+		ReceiptHandle:     &message.Metadata.ReceiptHandle,
+		VisibilityTimeout: aws.Int64(0),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Log("released message with ID: %s", message.Metadata.MessageId)
+
+	return nil
 }
 
 // Poll starts polling messages from the queue
 func (s *SQSClient) Poll() {
+	if err := s.Run(context.Background()); err != nil {
+		panic(err)
+	}
+}
+
+// getQueueUrls returns the URLs of the queues consumed by the client
+func (s *SQSClient) getQueueUrls() ([]*string, error) {
 	if s.ClientOptions.PrefixBased {
-		queues := s.GetQueues(s.ClientOptions.QueueName)
+		queueUrls, err := s.getQueues(s.ClientOptions.QueueName)
+
+		// Without queues the client has nothing to run, which is reported like a failed discovery so it can be restarted once they exist
+		if err == nil && len(queueUrls) == 0 {
+			err = fmt.Errorf("no queues found with prefix %s", s.ClientOptions.QueueName)
 
-		for _, queue := range queues {
-			ch := make(chan *sqs.Message)
+			s.health.DiscoveryFailed(s.ClientOptions.QueueName, err)
+		}
+
+		return queueUrls, err
+	}
 
-			go s.ReceiveMessages(*queue, ch)
+	queueUrl, err := s.getQueueUrl()
 
-			go func(queueUrl string) {
-				for message := range ch {
-					go s.ProcessMessage(message, queueUrl)
-				}
-			}(*queue)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*string{queueUrl}, nil
+}
+
+// Run polls messages from the queues until the context is cancelled or the client fails.
+// On cancellation it stops receiving, waits for the messages being processed and returns nil.
+// Otherwise it returns the first error that stopped the client (a failed receive or a panic in Handle).
+func (s *SQSClient) Run(ctx context.Context) error {
+	queueUrls, err := s.getQueueUrls()
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(queueUrls))
+
+	fail := func(err error) {
+		select {
+		case errs <- err:
+		default:
 		}
 
-		select {}
+		cancel()
 	}
 
-	ch := make(chan *sqs.Message)
+	var queues sync.WaitGroup
 
-	queueUrl := s.GetQueueUrl()
+	for _, queueUrl := range queueUrls {
+		queues.Add(1)
 
-	go s.ReceiveMessages(*queueUrl, ch)
+		go func(queueUrl string) {
+			defer queues.Done()
 
-	for message := range ch {
-		go s.ProcessMessage(message, *queueUrl)
+			s.runQueue(ctx, queueUrl, fail)
+		}(*queueUrl)
 	}
+
+	queues.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// runQueue receives and processes the messages of the queue until the context is cancelled, reporting fatal errors to fail
+func (s *SQSClient) runQueue(ctx context.Context, queueUrl string, fail func(error)) {
+	queueName := getQueueName(queueUrl)
+	batches := make(chan []*sqs.Message)
+
+	receivers := newReceiverGroup(ctx, func(loop context.Context) {
+		err := s.receiveMessages(ctx, loop, queueUrl, func(messages []*sqs.Message) {
+			if s.ClientOptions.HandleBatch != nil {
+				batches <- messages
+
+				return
+			}
+
+			// Messages are sent one by one, so the receiver waits until they are all taken by a worker
+			for _, message := range messages {
+				batches <- []*sqs.Message{message}
+			}
+		})
+
+		if err != nil {
+			fail(err)
+		}
+	})
+
+	workers := newConcurrencyLimiter(s.ClientOptions.Workers)
+	stats := &handlerStats{}
+
+	var controller sync.WaitGroup
+
+	if s.ClientOptions.AdaptiveConcurrency != nil {
+		workers.setLimit(s.ClientOptions.AdaptiveConcurrency.MinWorkers)
+		receivers.scale(s.ClientOptions.AdaptiveConcurrency.MinReceivers)
+
+		controller.Add(1)
+
+		go func() {
+			defer controller.Done()
+
+			s.adaptConcurrency(ctx, queueUrl, workers, receivers, stats)
+		}()
+	} else {
+		receivers.scale(s.ClientOptions.Receivers)
+	}
+
+	s.Logger.Log("started %d receivers for queue %s", receivers.size(), queueName)
+
+	go func() {
+		<-ctx.Done()
+
+		controller.Wait()
+		receivers.wait()
+
+		close(batches)
+	}()
+
+	var processing sync.WaitGroup
+
+	// work runs fn in a worker as soon as one is available
+	work := func(fn func() error) {
+		workers.acquire()
+		processing.Add(1)
+
+		go func() {
+			defer processing.Done()
+			defer workers.release()
+
+			if err := fn(); err != nil {
+				fail(err)
+			}
+		}()
+	}
+
+	received := 0
+
+	if s.ClientOptions.HandleBatch != nil {
+		received = s.accumulateBatches(batches, func(batch []*sqs.Message) {
+			work(func() error {
+				return s.safeProcessBatch(ctx, batch, queueUrl, stats)
+			})
+		})
+	} else {
+		for messages := range batches {
+			received += len(messages)
+
+			for _, message := range messages {
+				message := message
+
+				work(func() error {
+					start := time.Now()
+
+					handled, err := s.safeProcessMessage(ctx, message, queueUrl)
+
+					stats.record(time.Since(start), !handled)
+
+					return err
+				})
+			}
+		}
+	}
+
+	processing.Wait()
+
+	s.Logger.Log("stopped receivers for queue %s after receiving %d messages", queueName, received)
+}
+
+// safeProcessMessage processes the message, logging processing errors and turning a panic in Handle into an error
+func (s *SQSClient) safeProcessMessage(ctx context.Context, sqsMessage *sqs.Message, queueUrl string) (handled bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while handling message: %v", r)
+		}
+	}()
+
+	handled, processErr := s.processMessage(ctx, sqsMessage, queueUrl)
+
+	if processErr != nil {
+		s.health.Failed(getQueueName(queueUrl), processErr)
+
+		s.Logger.Log("failed to process message with ID %s: %s", *sqsMessage.MessageId, processErr.Error())
+	}
+
+	return handled, nil
 }
 
 func (s *SQSClient) Start() {
@@ -1,14 +1,19 @@
 package consumer_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/inaciogu/go-sqs/consumer"
+	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/codec"
+	"github.com/inaciogu/go-sqs/compression"
 	"github.com/inaciogu/go-sqs/consumer/message"
 	"github.com/inaciogu/go-sqs/mocks"
 	"github.com/stretchr/testify/assert"
@@ -137,11 +142,12 @@ func (ut *UnitTest) TestReceiveMessage() {
 	fmt.Println(len(ch))
 
 	ut.mockSQSService.AssertCalled(ut.T(), "ReceiveMessage", &sqs.ReceiveMessageInput{
-		QueueUrl:            aws.String("https://fake-queue-url"),
-		MaxNumberOfMessages: aws.Int64(10),
-		VisibilityTimeout:   aws.Int64(30),
-		WaitTimeSeconds:     aws.Int64(20),
-		AttributeNames:      []*string{aws.String("All")},
+		QueueUrl:              aws.String("https://fake-queue-url"),
+		MaxNumberOfMessages:   aws.Int64(10),
+		VisibilityTimeout:     aws.Int64(30),
+		WaitTimeSeconds:       aws.Int64(20),
+		AttributeNames:        []*string{aws.String("All")},
+		MessageAttributeNames: []*string{aws.String("All")},
 	})
 	ut.Assert().Equal(1, len(ch))
 }
@@ -206,6 +212,8 @@ func (uts *UnitTest) TestProcessMessage_Handled() {
 
 	message := &sqs.Message{
 		Body: aws.String(`{
+			"Type": "Notification",
+			"TopicArn": "arn:aws:sns:us-east-1:123456789012:topic",
 			"Message": "{\n  \"asda\": \"asdas\"\n}",
 			"MessageId": "fake-message-id",
 			"ReceiptHandle": "fake-receipt-handle",
@@ -230,6 +238,41 @@ func (uts *UnitTest) TestProcessMessage_Handled() {
 	})
 }
 
+func (uts *UnitTest) TestProcessMessage_Ack() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil).Once()
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(nil, errors.New("erro")).Once()
+
+	acks := 0
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			message.OnAck(func() {
+				acks++
+			})
+
+			return true
+		},
+	})
+
+	sqsMessage := &sqs.Message{
+		Body:          aws.String(`{"content": "fake-content"}`),
+		ReceiptHandle: aws.String("fake-receipt-handle"),
+		MessageId:     aws.String("fake-message-id"),
+	}
+
+	client.ProcessMessage(sqsMessage, "https://fake-queue-url")
+
+	uts.Equal(1, acks)
+
+	// The hooks are not called when the message can not be deleted
+	uts.Panics(func() {
+		client.ProcessMessage(sqsMessage, "https://fake-queue-url")
+	})
+
+	uts.Equal(1, acks)
+}
+
 func (uts *UnitTest) TestProcessMessage_Not_Handled_Error() {
 	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
 		QueueUrl: aws.String("https://fake-queue-url"),
@@ -277,11 +320,8 @@ func (uts *UnitTest) TestProcessMessage_Not_Handled() {
 		Body:          aws.String(`{"content": "fake-content"}`),
 		ReceiptHandle: aws.String("fake-receipt-handle"),
 		MessageId:     aws.String("fake-message-id"),
-		MessageAttributes: map[string]*sqs.MessageAttributeValue{
-			"ApproximateReceiveCount": {
-				DataType:    aws.String("String"),
-				StringValue: aws.String("2"),
-			},
+		Attributes: map[string]*string{
+			"ApproximateReceiveCount": aws.String("2"),
 		},
 	}
 
@@ -329,11 +369,12 @@ func (uts *UnitTest) TestPoll() {
 	time.Sleep(600 * time.Millisecond)
 
 	uts.mockSQSService.AssertCalled(uts.T(), "ReceiveMessage", &sqs.ReceiveMessageInput{
-		QueueUrl:            aws.String("https://fake-queue-url"),
-		MaxNumberOfMessages: aws.Int64(10),
-		VisibilityTimeout:   aws.Int64(30),
-		WaitTimeSeconds:     aws.Int64(20),
-		AttributeNames:      []*string{aws.String("All")},
+		QueueUrl:              aws.String("https://fake-queue-url"),
+		MaxNumberOfMessages:   aws.Int64(10),
+		VisibilityTimeout:     aws.Int64(30),
+		WaitTimeSeconds:       aws.Int64(20),
+		AttributeNames:        []*string{aws.String("All")},
+		MessageAttributeNames: []*string{aws.String("All")},
 	})
 	uts.mockSQSService.AssertCalled(uts.T(), "GetQueueUrl", &sqs.GetQueueUrlInput{
 		QueueName: aws.String("fake-queue-name"),
@@ -438,10 +479,471 @@ func (uts *UnitTest) TestStart() {
 	time.Sleep(600 * time.Millisecond)
 
 	uts.mockSQSService.AssertCalled(uts.T(), "ReceiveMessage", &sqs.ReceiveMessageInput{
-		QueueUrl:            aws.String("https://fake-queue-url"),
-		MaxNumberOfMessages: aws.Int64(10),
-		VisibilityTimeout:   aws.Int64(30),
-		WaitTimeSeconds:     aws.Int64(20),
-		AttributeNames:      []*string{aws.String("All")},
+		QueueUrl:              aws.String("https://fake-queue-url"),
+		MaxNumberOfMessages:   aws.Int64(10),
+		VisibilityTimeout:     aws.Int64(30),
+		WaitTimeSeconds:       aws.Int64(20),
+		AttributeNames:        []*string{aws.String("All")},
+		MessageAttributeNames: []*string{aws.String("All")},
+	})
+}
+
+func (uts *UnitTest) TestHealth() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+	})
+
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(&sqs.ReceiveMessageOutput{}, nil)
+
+	go client.Start()
+
+	time.Sleep(600 * time.Millisecond)
+
+	statuses := client.Health()
+
+	uts.Len(statuses, 1)
+	uts.Equal("fake-queue-name", statuses[0].Queue)
+	uts.True(statuses[0].DiscoverySucceeded)
+	uts.NotNil(statuses[0].LastReceiveAt)
+	uts.True(statuses[0].Healthy())
+}
+
+func (uts *UnitTest) TestHealth_DiscoveryFailed() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{}, errors.New("erro"))
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+	})
+
+	assert.Panics(uts.T(), func() {
+		client.GetQueueUrl()
+	})
+
+	statuses := client.Health()
+
+	uts.Len(statuses, 1)
+	uts.False(statuses[0].DiscoverySucceeded)
+	uts.Equal("erro", statuses[0].LastError)
+}
+
+func (uts *UnitTest) TestHealth_DiscoveryRecovered() {
+	uts.mockSQSService.On("ListQueues", mock.Anything).Return(nil, errors.New("list error")).Once()
+	uts.mockSQSService.On("ListQueues", mock.Anything).Return(&sqs.ListQueuesOutput{
+		QueueUrls: []*string{aws.String("https://fake-queue-url/orders-a")},
+	}, nil)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName:   "orders",
+		PrefixBased: true,
+	})
+
+	uts.Panics(func() {
+		client.GetQueues("orders")
+	})
+
+	uts.False(client.Health()[0].Healthy())
+
+	client.GetQueues("orders")
+
+	statuses := client.Health()
+
+	uts.Len(statuses, 1)
+	uts.Equal("orders-a", statuses[0].Queue)
+	uts.True(statuses[0].Healthy())
+}
+
+func (uts *UnitTest) TestRun() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url"),
+	}, nil)
+
+	handled := make(chan bool, 10)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			handled <- true
+
+			return true
+		},
+	})
+
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(&sqs.ReceiveMessageOutput{
+		Messages: []*sqs.Message{
+			{
+				Body:          aws.String(`{"content": "fake-content"}`),
+				ReceiptHandle: aws.String("fake-receipt-handle"),
+				MessageId:     aws.String("fake-message-id"),
+			},
+		},
+	}, nil)
+
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	err := client.Run(ctx)
+
+	uts.NoError(err)
+	uts.Len(handled, 1)
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "ReceiveMessage", 1)
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessage", 1)
+}
+
+func (uts *UnitTest) TestRun_DiscoveryError() {
+	uts.mockSQSService.On("ListQueues", mock.Anything).Return(nil, errors.New("list error"))
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName:   "fake-queue-name",
+		PrefixBased: true,
+	})
+
+	uts.EqualError(client.Run(context.Background()), "list error")
+}
+
+func (uts *UnitTest) TestRun_NoQueues() {
+	uts.mockSQSService.On("ListQueues", mock.Anything).Return(&sqs.ListQueuesOutput{}, nil)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName:   "fake-queue-name",
+		PrefixBased: true,
+	})
+
+	uts.EqualError(client.Run(context.Background()), "no queues found with prefix fake-queue-name")
+
+	statuses := client.Health()
+
+	uts.Len(statuses, 1)
+	uts.False(statuses[0].Healthy())
+}
+
+func (uts *UnitTest) TestRun_ReceiveError() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url"),
+	}, nil)
+
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(&sqs.ReceiveMessageOutput{}, errors.New("receive error"))
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+	})
+
+	uts.EqualError(client.Run(context.Background()), "receive error")
+}
+
+func (uts *UnitTest) TestRun_HandlePanic() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url"),
+	}, nil)
+
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(&sqs.ReceiveMessageOutput{
+		Messages: []*sqs.Message{
+			{
+				Body:          aws.String(`{"content": "fake-content"}`),
+				ReceiptHandle: aws.String("fake-receipt-handle"),
+				MessageId:     aws.String("fake-message-id"),
+			},
+		},
+	}, nil)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			panic("boom")
+		},
+	})
+
+	uts.EqualError(client.Run(context.Background()), "panic while handling message: boom")
+}
+
+func (uts *UnitTest) TestRun_ProcessErrorIsNotFatal() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url"),
+	}, nil)
+
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(&sqs.ReceiveMessageOutput{
+		Messages: []*sqs.Message{
+			{
+				Body:          aws.String(`{"content": "fake-content"}`),
+				ReceiptHandle: aws.String("fake-receipt-handle"),
+				MessageId:     aws.String("fake-message-id"),
+			},
+		},
+	}, nil)
+
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(nil, errors.New("delete error"))
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 700*time.Millisecond)
+	defer cancel()
+
+	uts.NoError(client.Run(ctx))
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "ReceiveMessage", 2)
+}
+
+func (uts *UnitTest) TestProcessMessage_Codec() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	body, _ := codec.Encode(codec.MessagePack, map[string]string{"content": "fake-content"})
+	content := ""
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			decoded := map[string]string{}
+
+			if err := message.Unmarshal(&decoded); err != nil {
+				return false
+			}
+
+			content = decoded["content"]
+
+			return true
+		},
+		Codec: codec.MessagePack,
+	})
+
+	client.ProcessMessage(&sqs.Message{
+		Body:          aws.String(body),
+		ReceiptHandle: aws.String("fake-receipt-handle"),
+		MessageId:     aws.String("fake-message-id"),
+	}, "https://fake-queue-url")
+
+	uts.Equal("fake-content", content)
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessage", 1)
+}
+
+// receiveWithAttributes returns the message on every ReceiveMessage call. Like SQS, its message attributes are only returned when they are requested.
+func (uts *UnitTest) receiveWithAttributes(sqsMessage *sqs.Message) {
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(func(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+		received := *sqsMessage
+
+		if !reflect.DeepEqual(aws.StringValueSlice(input.MessageAttributeNames), []string{"All"}) {
+			received.MessageAttributes = nil
+		}
+
+		return &sqs.ReceiveMessageOutput{Messages: []*sqs.Message{&received}}, nil
+	})
+}
+
+func (uts *UnitTest) TestRun_ContentType() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	body, _ := codec.Encode(codec.MessagePack, map[string]string{"content": "fake-content"})
+
+	uts.receiveWithAttributes(&sqs.Message{
+		Body:          aws.String(body),
+		ReceiptHandle: aws.String("fake-receipt-handle"),
+		MessageId:     aws.String("fake-message-id"),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"content-type": {DataType: aws.String("String"), StringValue: aws.String(codec.MessagePack.ContentType())},
+		},
+	})
+
+	contents := make(chan string, 10)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			decoded := map[string]string{}
+
+			if err := message.Unmarshal(&decoded); err != nil {
+				return false
+			}
+
+			contents <- decoded["content"]
+
+			return true
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(700*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Require().NotEmpty(contents)
+	uts.Equal("fake-content", <-contents)
+}
+
+func (uts *UnitTest) TestProcessMessage_Compressed() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	body, _ := compression.Encode(compression.Gzip, `{"content": "fake-content"}`)
+	content := ""
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			content = message.Content
+
+			return true
+		},
+	})
+
+	client.ProcessMessage(&sqs.Message{
+		Body:          aws.String(body),
+		ReceiptHandle: aws.String("fake-receipt-handle"),
+		MessageId:     aws.String("fake-message-id"),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"content-encoding": {DataType: aws.String("String"), StringValue: aws.String("gzip")},
+		},
+	}, "https://fake-queue-url")
+
+	uts.Equal(`{"content": "fake-content"}`, content)
+}
+
+func (uts *UnitTest) TestRun_Compressed() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	body, _ := compression.Encode(compression.Gzip, `{"content": "fake-content"}`)
+
+	uts.receiveWithAttributes(&sqs.Message{
+		Body:          aws.String(body),
+		ReceiptHandle: aws.String("fake-receipt-handle"),
+		MessageId:     aws.String("fake-message-id"),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"content-encoding": {DataType: aws.String("String"), StringValue: aws.String("gzip")},
+		},
+	})
+
+	contents := make(chan string, 10)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			contents <- message.Content
+
+			return true
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(700*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Require().NotEmpty(contents)
+	uts.Equal(`{"content": "fake-content"}`, <-contents)
+}
+
+func (uts *UnitTest) TestRun_UnknownEncodingIsBackedOff() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(&sqs.ReceiveMessageOutput{
+		Messages: []*sqs.Message{
+			{
+				Body:          aws.String("fake-content"),
+				ReceiptHandle: aws.String("fake-receipt-handle"),
+				MessageId:     aws.String("fake-message-id"),
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					"content-encoding": {DataType: aws.String("String"), StringValue: aws.String("br")},
+				},
+			},
+		},
+	}, nil)
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	calls := int32(0)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			atomic.AddInt32(&calls, 1)
+
+			return true
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(700*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Equal(int32(0), atomic.LoadInt32(&calls))
+	uts.mockSQSService.AssertCalled(uts.T(), "ChangeMessageVisibility", mock.MatchedBy(func(input *sqs.ChangeMessageVisibilityInput) bool {
+		return *input.ReceiptHandle == "fake-receipt-handle" && *input.VisibilityTimeout > 0
+	}))
+	uts.mockSQSService.AssertNotCalled(uts.T(), "DeleteMessage", mock.Anything)
+	uts.Contains(client.Health()[0].LastError, "unknown content encoding br")
+}
+
+func (uts *UnitTest) TestProcessMessage_SourceSNS() {
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+		Source: message.SourceSNS,
+	})
+
+	uts.PanicsWithError("message fake-message-id is not an SNS notification", func() {
+		client.ProcessMessage(&sqs.Message{
+			Body:          aws.String(`{"content": "fake-content"}`),
+			ReceiptHandle: aws.String("fake-receipt-handle"),
+			MessageId:     aws.String("fake-message-id"),
+		}, "https://fake-queue-url")
+	})
+
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "ChangeMessageVisibility", 1)
+}
+
+func (uts *UnitTest) TestProcessMessage_SourceRaw() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	body := `{"Type": "Notification", "TopicArn": "arn:aws:sns:us-east-1:123456789012:topic", "Message": "fake-message"}`
+	content := ""
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			content = message.Content
+
+			return true
+		},
+		Source: message.SourceRaw,
+	})
+
+	client.ProcessMessage(&sqs.Message{
+		Body:          aws.String(body),
+		ReceiptHandle: aws.String("fake-receipt-handle"),
+		MessageId:     aws.String("fake-message-id"),
+	}, "https://fake-queue-url")
+
+	uts.Equal(body, content)
+}
+
+func (uts *UnitTest) TestNew_UnknownSource() {
+	uts.PanicsWithValue("unknown Source fake-source", func() {
+		consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+			QueueName: "fake-queue-name",
+			Source:    "fake-source",
+		})
 	})
 }
@@ -0,0 +1,35 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/inaciogu/go-sqs/encryption"
+)
+
+type EncryptionOptions struct {
+	// Provider decrypts the data keys of the messages
+	Provider encryption.KeyProvider
+	// Required rejects the messages that are not encrypted, so plaintext sent by a misconfigured producer is never handled
+	Required bool
+}
+
+// decrypt decrypts the content of the message when it is encrypted
+func (s *SQSClient) decrypt(ctx context.Context, message *message.Message) error {
+	options := s.ClientOptions.Encryption
+
+	if !encryption.Encrypted(message.Metadata.MessageAttributes) {
+		if options != nil && options.Required {
+			return fmt.Errorf("message %s is not encrypted", message.Metadata.MessageId)
+		}
+
+		return nil
+	}
+
+	if options == nil {
+		return fmt.Errorf("message %s is encrypted but no encryption provider is configured", message.Metadata.MessageId)
+	}
+
+	return message.Decrypt(ctx, options.Provider)
+}
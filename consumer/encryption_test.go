@@ -0,0 +1,156 @@
+package consumer_test
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/inaciogu/go-sqs/encryption"
+	"github.com/stretchr/testify/mock"
+)
+
+func (uts *UnitTest) newEncryptedMessage(provider encryption.KeyProvider, content string) *sqs.Message {
+	body, attributes, err := encryption.Encrypt(context.Background(), provider, content)
+
+	uts.Require().NoError(err)
+
+	sqsMessage := &sqs.Message{
+		Body:              aws.String(body),
+		ReceiptHandle:     aws.String("fake-receipt-handle"),
+		MessageId:         aws.String("fake-message-id"),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{},
+	}
+
+	for key, value := range attributes {
+		sqsMessage.MessageAttributes[key] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+	}
+
+	return sqsMessage
+}
+
+func (uts *UnitTest) TestEncryption_Decrypts() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	provider, _ := encryption.NewStaticKeyProvider("fake-key-id", bytes.Repeat([]byte("k"), 32))
+	content := ""
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			content = message.Content
+
+			return true
+		},
+		Encryption: &consumer.EncryptionOptions{Provider: provider},
+	})
+
+	client.ProcessMessage(uts.newEncryptedMessage(provider, `{"email": "test@test.com"}`), "https://fake-queue-url")
+
+	uts.Equal(`{"email": "test@test.com"}`, content)
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessage", 1)
+}
+
+func (uts *UnitTest) TestEncryption_WrongKeyIsBackedOff() {
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	producerProvider, _ := encryption.NewStaticKeyProvider("fake-key-id", bytes.Repeat([]byte("k"), 32))
+	consumerProvider, _ := encryption.NewStaticKeyProvider("fake-key-id", bytes.Repeat([]byte("x"), 32))
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+		Encryption: &consumer.EncryptionOptions{Provider: consumerProvider},
+	})
+
+	uts.PanicsWithError("failed to decrypt content of message fake-message-id: failed to decrypt data key: cipher: message authentication failed", func() {
+		client.ProcessMessage(uts.newEncryptedMessage(producerProvider, "fake-content"), "https://fake-queue-url")
+	})
+
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "ChangeMessageVisibility", 1)
+	uts.mockSQSService.AssertNotCalled(uts.T(), "DeleteMessage", mock.Anything)
+}
+
+func (uts *UnitTest) TestEncryption_Required() {
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	provider, _ := encryption.NewStaticKeyProvider("fake-key-id", bytes.Repeat([]byte("k"), 32))
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+		Encryption: &consumer.EncryptionOptions{Provider: provider, Required: true},
+	})
+
+	uts.PanicsWithError("message fake-message-id is not encrypted", func() {
+		client.ProcessMessage(&sqs.Message{
+			Body:          aws.String(`{"email": "test@test.com"}`),
+			ReceiptHandle: aws.String("fake-receipt-handle"),
+			MessageId:     aws.String("fake-message-id"),
+		}, "https://fake-queue-url")
+	})
+}
+
+func (uts *UnitTest) TestEncryption_WithoutProvider() {
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	provider, _ := encryption.NewStaticKeyProvider("fake-key-id", bytes.Repeat([]byte("k"), 32))
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+	})
+
+	uts.PanicsWithError("message fake-message-id is encrypted but no encryption provider is configured", func() {
+		client.ProcessMessage(uts.newEncryptedMessage(provider, "fake-content"), "https://fake-queue-url")
+	})
+}
+
+func (uts *UnitTest) TestEncryption_Run() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	provider, _ := encryption.NewStaticKeyProvider("fake-key-id", bytes.Repeat([]byte("k"), 32))
+	uts.receiveWithAttributes(uts.newEncryptedMessage(provider, `{"email": "test@test.com"}`))
+
+	contents := make(chan string, 10)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			contents <- message.Content
+
+			return true
+		},
+		Encryption: &consumer.EncryptionOptions{Provider: provider, Required: true},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(700*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Require().NotEmpty(contents)
+	uts.Equal(`{"email": "test@test.com"}`, <-contents)
+}
+
+func (uts *UnitTest) TestEncryption_NilProvider() {
+	uts.PanicsWithValue("Encryption requires a Provider", func() {
+		consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+			QueueName:  "fake-queue-name",
+			Encryption: &consumer.EncryptionOptions{Required: true},
+		})
+	})
+}
@@ -1,22 +1,388 @@
 package handler
 
-import sqsclient "github.com/inaciogu/go-sqs/consumer"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	sqsclient "github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/health"
+	"github.com/inaciogu/go-sqs/consumer/logger"
+)
+
+// RestartPolicy defines what the handler does when a client stops with an error
+type RestartPolicy int
+
+const (
+	// RestartNever treats the first client error as fatal
+	RestartNever RestartPolicy = iota
+	// RestartAlways restarts the client after RestartDelay, without increasing it
+	RestartAlways
+	// RestartWithBackoff restarts the client after an exponential backoff
+	RestartWithBackoff
+)
+
+const (
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = time.Minute
+	DefaultRestartDelay   = time.Second
+	DefaultStablePeriod   = time.Minute
+)
 
 // SQSHandler is responsible for running the SQS clients concurrently
 type SQSHandler struct {
 	Clients []sqsclient.SQSClientInterface
+	// HealthAddress is the address (e.g. ":8080") where the health handler is served while running. It is disabled when empty.
+	HealthAddress string
+	// RestartPolicy defines what happens when a client stops with an error. Defaults to RestartNever.
+	RestartPolicy RestartPolicy
+	// MaxRestarts is the number of restarts allowed per client before its error is considered fatal. Zero means unlimited.
+	MaxRestarts int
+	// InitialBackoff is the delay before the first restart when RestartPolicy is RestartWithBackoff. It doubles on each restart up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// RestartDelay is the delay before every restart when RestartPolicy is RestartAlways, so a permanent error does not restart the client
+	// in a tight loop. Defaults to DefaultRestartDelay.
+	RestartDelay time.Duration
+	// StablePeriod is how long a client has to run before a failure starts a new series of restarts: MaxRestarts counts the restarts
+	// since the client last ran that long, and the backoff starts again from InitialBackoff. Defaults to DefaultStablePeriod.
+	StablePeriod time.Duration
+	Logger       sqsclient.Logger
+
+	mu sync.Mutex
+	// run is the state of the current Run call, nil when the handler is not running
+	run *run
+}
+
+// run holds the state shared by the clients started during a Run call
+type run struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	clients map[string]*runningClient
+	errs    []error
+}
+
+type runningClient struct {
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 func New(clients []sqsclient.SQSClientInterface) *SQSHandler {
 	return &SQSHandler{
 		Clients: clients,
+		Logger:  logger.New(logger.DefaultLoggerConfig{LogLevel: "info"}),
 	}
 }
 
-func (h *SQSHandler) Run() {
+// HealthHandler returns an http.Handler that reports the health of the queues of every client that implements health.Reporter
+func (h *SQSHandler) HealthHandler() http.Handler {
+	return health.NewHandler(h.reporters)
+}
+
+func (h *SQSHandler) reporters() []health.Reporter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	reporters := []health.Reporter{}
+
 	for _, client := range h.Clients {
-		go client.Start()
+		if reporter, ok := client.(health.Reporter); ok {
+			reporters = append(reporters, reporter)
+		}
 	}
 
-	select {}
+	return reporters
+}
+
+// Run runs every client until the context is cancelled or a client fails with a fatal error.
+// Clients can be added and removed while it runs.
+// A fatal error stops all the clients; Run then returns the first fatal error joined with any other error returned while shutting down.
+func (h *SQSHandler) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	h.mu.Lock()
+
+	if h.run != nil {
+		h.mu.Unlock()
+
+		return errors.New("handler is already running")
+	}
+
+	// Handlers built as struct literals have no logger, which is needed to log the restarts
+	if h.Logger == nil {
+		h.Logger = logger.New(logger.DefaultLoggerConfig{LogLevel: "info"})
+	}
+
+	r := &run{
+		ctx:     ctx,
+		cancel:  cancel,
+		clients: make(map[string]*runningClient),
+	}
+
+	h.run = r
+
+	for _, client := range h.Clients {
+		h.start(r, client)
+	}
+
+	h.mu.Unlock()
+
+	if h.HealthAddress != "" {
+		server := &http.Server{Addr: h.HealthAddress, Handler: h.HealthHandler()}
+
+		r.wg.Add(1)
+
+		go func() {
+			defer r.wg.Done()
+
+			<-ctx.Done()
+
+			server.Shutdown(context.Background())
+		}()
+
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				h.fail(r, err)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+
+	h.mu.Lock()
+	h.run = nil
+	h.mu.Unlock()
+
+	r.wg.Wait()
+
+	return errors.Join(r.errs...)
+}
+
+// fail records a fatal error and stops every client of the run
+func (h *SQSHandler) fail(r *run, err error) {
+	h.mu.Lock()
+	r.errs = append(r.errs, err)
+	h.mu.Unlock()
+
+	r.cancel()
+}
+
+// start runs the client under supervision. It must be called with h.mu held.
+func (h *SQSHandler) start(r *run, client sqsclient.SQSClientInterface) {
+	name := client.GetQueueName()
+	ctx, cancel := context.WithCancel(r.ctx)
+
+	rc := &runningClient{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	r.clients[name] = rc
+	r.wg.Add(1)
+
+	go func() {
+		defer r.wg.Done()
+		defer close(rc.done)
+		defer cancel()
+
+		err := h.supervise(ctx, client)
+
+		h.mu.Lock()
+		if r.clients[name] == rc {
+			delete(r.clients, name)
+		}
+		h.mu.Unlock()
+
+		if err != nil {
+			h.fail(r, fmt.Errorf("client %s: %w", name, err))
+		}
+	}()
+}
+
+// Add adds a client to the handler, starting it right away if the handler is running
+func (h *SQSHandler) Add(client sqsclient.SQSClientInterface) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	name := client.GetQueueName()
+
+	for _, c := range h.Clients {
+		if c.GetQueueName() == name {
+			return fmt.Errorf("client %s already exists", name)
+		}
+	}
+
+	h.Clients = append(h.Clients, client)
+
+	if h.run != nil {
+		h.start(h.run, client)
+	}
+
+	return nil
+}
+
+// Remove removes the client with the given queue name from the handler.
+// If the client is running, it is stopped gracefully and Remove waits for the messages being processed.
+func (h *SQSHandler) Remove(name string) error {
+	h.mu.Lock()
+
+	index := -1
+
+	for i, c := range h.Clients {
+		if c.GetQueueName() == name {
+			index = i
+		}
+	}
+
+	if index == -1 {
+		h.mu.Unlock()
+
+		return fmt.Errorf("client %s not found", name)
+	}
+
+	h.Clients = append(h.Clients[:index:index], h.Clients[index+1:]...)
+
+	var rc *runningClient
+
+	if h.run != nil {
+		rc = h.run.clients[name]
+		delete(h.run.clients, name)
+	}
+
+	h.mu.Unlock()
+
+	if rc != nil {
+		rc.cancel()
+
+		<-rc.done
+	}
+
+	return nil
+}
+
+// List returns the queue names of the clients that are currently running
+func (h *SQSHandler) List() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	names := []string{}
+
+	if h.run == nil {
+		return names
+	}
+
+	for name := range h.run.clients {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Pause pauses the queue on every client that implements consumer.Pauser
+func (h *SQSHandler) Pause(queue string) {
+	for _, pauser := range h.pausers() {
+		pauser.Pause(queue)
+	}
+}
+
+// Resume resumes the queue on every client that implements consumer.Pauser
+func (h *SQSHandler) Resume(queue string) {
+	for _, pauser := range h.pausers() {
+		pauser.Resume(queue)
+	}
+}
+
+func (h *SQSHandler) pausers() []sqsclient.Pauser {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pausers := []sqsclient.Pauser{}
+
+	for _, client := range h.Clients {
+		if pauser, ok := client.(sqsclient.Pauser); ok {
+			pausers = append(pausers, pauser)
+		}
+	}
+
+	return pausers
+}
+
+// supervise runs the client and restarts it according to the restart policy, returning the error that should stop the handler
+func (h *SQSHandler) supervise(ctx context.Context, client sqsclient.SQSClientInterface) error {
+	initialBackoff := durationOrDefault(h.InitialBackoff, DefaultInitialBackoff)
+	maxBackoff := durationOrDefault(h.MaxBackoff, DefaultMaxBackoff)
+	stablePeriod := durationOrDefault(h.StablePeriod, DefaultStablePeriod)
+
+	restarts := 0
+	backoff := initialBackoff
+
+	for {
+		started := time.Now()
+		err := runClient(ctx, client)
+
+		if err == nil || ctx.Err() != nil {
+			return nil
+		}
+
+		// A client that ran long enough recovered from its previous failures
+		if time.Since(started) >= stablePeriod {
+			restarts = 0
+			backoff = initialBackoff
+		}
+
+		if h.RestartPolicy == RestartNever || (h.MaxRestarts > 0 && restarts >= h.MaxRestarts) {
+			return err
+		}
+
+		restarts++
+
+		delay := backoff
+
+		if h.RestartPolicy == RestartAlways {
+			delay = durationOrDefault(h.RestartDelay, DefaultRestartDelay)
+		}
+
+		h.Logger.Log("restarting client in %s after error: %s", delay.String(), err.Error())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		if h.RestartPolicy == RestartWithBackoff {
+			backoff *= 2
+
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+}
+
+func durationOrDefault(duration, defaultDuration time.Duration) time.Duration {
+	if duration == 0 {
+		return defaultDuration
+	}
+
+	return duration
+}
+
+// runClient runs the client, turning a panic into an error
+func runClient(ctx context.Context, client sqsclient.SQSClientInterface) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("client panicked: %v", r)
+		}
+	}()
+
+	return client.Run(ctx)
 }
@@ -1,12 +1,17 @@
 package handler_test
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	sqsclient "github.com/inaciogu/go-sqs/consumer"
 	"github.com/inaciogu/go-sqs/consumer/handler"
 	"github.com/inaciogu/go-sqs/mocks"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -18,8 +23,10 @@ type UnitTest struct {
 
 func (u *UnitTest) SetupTest() {
 	exampleClient1 := new(mocks.SQSClientInterface)
+	exampleClient1.On("GetQueueName").Return("queue-1")
 
 	exampleClient2 := new(mocks.SQSClientInterface)
+	exampleClient2.On("GetQueueName").Return("queue-2")
 
 	u.clients = []*mocks.SQSClientInterface{
 		exampleClient1,
@@ -36,16 +43,258 @@ func TestUnitSuites(t *testing.T) {
 	suite.Run(t, &UnitTest{})
 }
 
+func waitForCancel(args mock.Arguments) {
+	<-args.Get(0).(context.Context).Done()
+}
+
 func (ut *UnitTest) TestRun() {
 	for _, client := range ut.clients {
-		client.On("Start").Return()
+		client.On("Run", mock.Anything).Run(waitForCancel).Return(nil)
 	}
 
-	go ut.handler.Run()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+
+	go func() {
+		done <- ut.handler.Run(ctx)
+	}()
 
 	time.Sleep(100 * time.Millisecond)
 
 	for _, client := range ut.clients {
-		client.AssertCalled(ut.T(), "Start")
+		client.AssertCalled(ut.T(), "Run", mock.Anything)
+	}
+
+	cancel()
+
+	ut.NoError(<-done)
+}
+
+func (ut *UnitTest) TestRun_FatalError() {
+	ut.clients[0].On("Run", mock.Anything).Return(errors.New("receive error"))
+	ut.clients[1].On("Run", mock.Anything).Run(waitForCancel).Return(nil)
+
+	err := ut.handler.Run(context.Background())
+
+	ut.EqualError(err, "client queue-1: receive error")
+	ut.clients[0].AssertNumberOfCalls(ut.T(), "Run", 1)
+}
+
+func (ut *UnitTest) TestRun_Panic() {
+	ut.clients[0].On("Run", mock.Anything).Panic("boom")
+	ut.clients[1].On("Run", mock.Anything).Run(waitForCancel).Return(nil)
+
+	err := ut.handler.Run(context.Background())
+
+	ut.EqualError(err, "client queue-1: client panicked: boom")
+}
+
+func (ut *UnitTest) TestRun_RestartAlways() {
+	ut.handler.RestartPolicy = handler.RestartAlways
+	ut.handler.MaxRestarts = 2
+	ut.handler.RestartDelay = 10 * time.Millisecond
+
+	ut.clients[0].On("Run", mock.Anything).Return(errors.New("receive error"))
+	ut.clients[1].On("Run", mock.Anything).Run(waitForCancel).Return(nil)
+
+	err := ut.handler.Run(context.Background())
+
+	ut.EqualError(err, "client queue-1: receive error")
+	ut.clients[0].AssertNumberOfCalls(ut.T(), "Run", 3)
+}
+
+func (ut *UnitTest) TestRun_RestartWithoutLogger() {
+	sqsHandler := &handler.SQSHandler{
+		Clients:       []sqsclient.SQSClientInterface{ut.clients[0]},
+		RestartPolicy: handler.RestartAlways,
+		MaxRestarts:   1,
+		RestartDelay:  10 * time.Millisecond,
+	}
+
+	ut.clients[0].On("Run", mock.Anything).Return(errors.New("receive error"))
+
+	err := sqsHandler.Run(context.Background())
+
+	ut.EqualError(err, "client queue-1: receive error")
+	ut.clients[0].AssertNumberOfCalls(ut.T(), "Run", 2)
+}
+
+func (ut *UnitTest) TestRun_RestartAlways_Delay() {
+	ut.handler.RestartPolicy = handler.RestartAlways
+	ut.handler.MaxRestarts = 2
+	ut.handler.RestartDelay = 50 * time.Millisecond
+
+	ut.clients[0].On("Run", mock.Anything).Return(errors.New("AccessDenied"))
+	ut.clients[1].On("Run", mock.Anything).Run(waitForCancel).Return(nil)
+
+	started := time.Now()
+
+	err := ut.handler.Run(context.Background())
+
+	ut.EqualError(err, "client queue-1: AccessDenied")
+	ut.GreaterOrEqual(time.Since(started), 100*time.Millisecond)
+	ut.clients[0].AssertNumberOfCalls(ut.T(), "Run", 3)
+}
+
+func (ut *UnitTest) TestRun_StablePeriodResetsRestarts() {
+	ut.handler.RestartPolicy = handler.RestartWithBackoff
+	ut.handler.MaxRestarts = 1
+	ut.handler.InitialBackoff = 10 * time.Millisecond
+	ut.handler.StablePeriod = 50 * time.Millisecond
+
+	// The second run lasts longer than the stable period, so its failure gets a new restart
+	ut.clients[0].On("Run", mock.Anything).Return(errors.New("receive error")).Once()
+	ut.clients[0].On("Run", mock.Anything).After(100 * time.Millisecond).Return(errors.New("receive error")).Once()
+	ut.clients[0].On("Run", mock.Anything).Return(errors.New("receive error"))
+	ut.clients[1].On("Run", mock.Anything).Run(waitForCancel).Return(nil)
+
+	err := ut.handler.Run(context.Background())
+
+	ut.EqualError(err, "client queue-1: receive error")
+	ut.clients[0].AssertNumberOfCalls(ut.T(), "Run", 3)
+}
+
+func (ut *UnitTest) TestRun_RestartWithBackoff() {
+	ut.handler.RestartPolicy = handler.RestartWithBackoff
+	ut.handler.InitialBackoff = 10 * time.Millisecond
+
+	ut.clients[0].On("Run", mock.Anything).Return(errors.New("receive error")).Once()
+	ut.clients[0].On("Run", mock.Anything).Return(nil).Once()
+	ut.clients[1].On("Run", mock.Anything).Return(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := ut.handler.Run(ctx)
+
+	ut.NoError(err)
+	ut.clients[0].AssertNumberOfCalls(ut.T(), "Run", 2)
+}
+
+func (ut *UnitTest) TestRun_RestartWithBackoff_Cancelled() {
+	ut.handler.RestartPolicy = handler.RestartWithBackoff
+	ut.handler.InitialBackoff = time.Hour
+
+	ut.clients[0].On("Run", mock.Anything).Return(errors.New("receive error"))
+	ut.clients[1].On("Run", mock.Anything).Run(waitForCancel).Return(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	ut.NoError(ut.handler.Run(ctx))
+	ut.clients[0].AssertNumberOfCalls(ut.T(), "Run", 1)
+}
+
+func (ut *UnitTest) TestRun_AlreadyRunning() {
+	for _, client := range ut.clients {
+		client.On("Run", mock.Anything).Run(waitForCancel).Return(nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	go ut.handler.Run(ctx)
+
+	time.Sleep(10 * time.Millisecond)
+
+	ut.EqualError(ut.handler.Run(ctx), "handler is already running")
+}
+
+func (ut *UnitTest) TestAddAndRemove() {
+	for _, client := range ut.clients {
+		client.On("Run", mock.Anything).Run(waitForCancel).Return(nil)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+
+	go func() {
+		done <- ut.handler.Run(ctx)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	ut.Equal([]string{"queue-1", "queue-2"}, ut.handler.List())
+
+	stopped := make(chan struct{})
+
+	newClient := new(mocks.SQSClientInterface)
+	newClient.On("GetQueueName").Return("queue-3")
+	newClient.On("Run", mock.Anything).Run(func(args mock.Arguments) {
+		waitForCancel(args)
+
+		close(stopped)
+	}).Return(nil)
+
+	ut.NoError(ut.handler.Add(newClient))
+	ut.EqualError(ut.handler.Add(newClient), "client queue-3 already exists")
+
+	time.Sleep(10 * time.Millisecond)
+
+	ut.Equal([]string{"queue-1", "queue-2", "queue-3"}, ut.handler.List())
+	newClient.AssertCalled(ut.T(), "Run", mock.Anything)
+
+	ut.NoError(ut.handler.Remove("queue-3"))
+
+	select {
+	case <-stopped:
+	default:
+		ut.Fail("Remove returned before the client stopped")
 	}
+
+	ut.Equal([]string{"queue-1", "queue-2"}, ut.handler.List())
+	ut.Len(ut.handler.Clients, 2)
+	ut.EqualError(ut.handler.Remove("queue-3"), "client queue-3 not found")
+
+	cancel()
+
+	ut.NoError(<-done)
+	ut.Empty(ut.handler.List())
+}
+
+func (ut *UnitTest) TestAddAndRemoveWhileNotRunning() {
+	newClient := new(mocks.SQSClientInterface)
+	newClient.On("GetQueueName").Return("queue-3")
+
+	ut.NoError(ut.handler.Add(newClient))
+	ut.Len(ut.handler.Clients, 3)
+
+	ut.NoError(ut.handler.Remove("queue-1"))
+	ut.Len(ut.handler.Clients, 2)
+	ut.Empty(ut.handler.List())
+
+	newClient.AssertNotCalled(ut.T(), "Run", mock.Anything)
+}
+
+func (ut *UnitTest) TestHealthHandler() {
+	client := sqsclient.New(new(mocks.SQSService), sqsclient.SQSClientOptions{
+		QueueName: "fake-queue-name",
+	})
+
+	h := handler.New([]sqsclient.SQSClientInterface{client, ut.clients[0]})
+
+	recorder := httptest.NewRecorder()
+
+	h.HealthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	ut.Equal(http.StatusOK, recorder.Code)
+	ut.JSONEq(`{"healthy":true,"queues":[]}`, recorder.Body.String())
+}
+
+func (ut *UnitTest) TestPauseAndResume() {
+	client := sqsclient.New(new(mocks.SQSService), sqsclient.SQSClientOptions{
+		QueueName: "fake-queue-name",
+	})
+
+	h := handler.New([]sqsclient.SQSClientInterface{client, ut.clients[0]})
+
+	h.Pause("fake-queue-name")
+
+	ut.True(client.IsPaused("fake-queue-name"))
+
+	h.Resume("fake-queue-name")
+
+	ut.False(client.IsPaused("fake-queue-name"))
 }
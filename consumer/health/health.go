@@ -0,0 +1,199 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueueStatus is the health snapshot of a single queue consumed by a client
+type QueueStatus struct {
+	Queue              string     `json:"queue"`
+	DiscoverySucceeded bool       `json:"discovery_succeeded"`
+	LastReceiveAt      *time.Time `json:"last_receive_at,omitempty"`
+	LastError          string     `json:"last_error,omitempty"`
+	LastErrorAt        *time.Time `json:"last_error_at,omitempty"`
+	InFlight           int64      `json:"in_flight"`
+	// Workers and Receivers are the current concurrency of the queue when it is adjusted at runtime
+	Workers   int `json:"workers,omitempty"`
+	Receivers int `json:"receivers,omitempty"`
+}
+
+// Healthy reports whether the queue was discovered and its last receive did not fail
+func (q QueueStatus) Healthy() bool {
+	if !q.DiscoverySucceeded {
+		return false
+	}
+
+	if q.LastErrorAt == nil {
+		return true
+	}
+
+	return q.LastReceiveAt != nil && q.LastReceiveAt.After(*q.LastErrorAt)
+}
+
+// Reporter is implemented by clients that are able to report the health of their queues
+type Reporter interface {
+	Health() []QueueStatus
+}
+
+// Tracker records the health events of the queues consumed by a client. It is safe for concurrent use.
+type Tracker struct {
+	mu     sync.Mutex
+	queues map[string]*QueueStatus
+	now    func() time.Time
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		queues: make(map[string]*QueueStatus),
+		now:    time.Now,
+	}
+}
+
+func (t *Tracker) queue(name string) *QueueStatus {
+	status, ok := t.queues[name]
+
+	if !ok {
+		status = &QueueStatus{Queue: name}
+		t.queues[name] = status
+	}
+
+	return status
+}
+
+// Discovered marks the queue as successfully resolved
+func (t *Tracker) Discovered(queue string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.queue(queue).DiscoverySucceeded = true
+}
+
+// DiscoveryFailed marks the queue as not resolved and records the error
+func (t *Tracker) DiscoveryFailed(queue string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := t.queue(queue)
+	status.DiscoverySucceeded = false
+	t.setError(status, err)
+}
+
+// Remove stops tracking the queue, e.g. a prefix whose discovery failed before succeeding
+func (t *Tracker) Remove(queue string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.queues, queue)
+}
+
+// Received records a successful receive on the queue
+func (t *Tracker) Received(queue string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.queue(queue).LastReceiveAt = &now
+}
+
+// Failed records an error that happened while consuming the queue
+func (t *Tracker) Failed(queue string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.setError(t.queue(queue), err)
+}
+
+func (t *Tracker) setError(status *QueueStatus, err error) {
+	now := t.now()
+	status.LastError = err.Error()
+	status.LastErrorAt = &now
+}
+
+// Acquire increments the number of messages being processed from the queue
+func (t *Tracker) Acquire(queue string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.queue(queue).InFlight++
+}
+
+// Release decrements the number of messages being processed from the queue
+func (t *Tracker) Release(queue string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.queue(queue).InFlight--
+}
+
+// SetConcurrency records the number of workers and receivers of the queue
+func (t *Tracker) SetConcurrency(queue string, workers int, receivers int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := t.queue(queue)
+	status.Workers = workers
+	status.Receivers = receivers
+}
+
+// Statuses returns a snapshot of every tracked queue sorted by queue name
+func (t *Tracker) Statuses() []QueueStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := make([]QueueStatus, 0, len(t.queues))
+
+	for _, status := range t.queues {
+		statuses = append(statuses, *status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Queue < statuses[j].Queue
+	})
+
+	return statuses
+}
+
+// Report is the body written by the health handler
+type Report struct {
+	Healthy bool          `json:"healthy"`
+	Queues  []QueueStatus `json:"queues"`
+}
+
+type handler struct {
+	reporters func() []Reporter
+}
+
+// NewHandler returns an http.Handler that reports the health of every queue of the given reporters.
+// It responds with 200 when every queue is healthy and 503 otherwise, so it can be used by liveness and readiness probes.
+func NewHandler(reporters func() []Reporter) http.Handler {
+	return &handler{reporters: reporters}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := Report{
+		Healthy: true,
+		Queues:  []QueueStatus{},
+	}
+
+	for _, reporter := range h.reporters() {
+		for _, status := range reporter.Health() {
+			if !status.Healthy() {
+				report.Healthy = false
+			}
+
+			report.Queues = append(report.Queues, status)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if !report.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
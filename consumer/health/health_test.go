@@ -0,0 +1,124 @@
+package health_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/inaciogu/go-sqs/consumer/health"
+	"github.com/stretchr/testify/suite"
+)
+
+type UnitTest struct {
+	suite.Suite
+	tracker *health.Tracker
+}
+
+func (ut *UnitTest) SetupTest() {
+	ut.tracker = health.NewTracker()
+}
+
+func TestUnitSuites(t *testing.T) {
+	suite.Run(t, &UnitTest{})
+}
+
+func (ut *UnitTest) serve() (*httptest.ResponseRecorder, health.Report) {
+	handler := health.NewHandler(func() []health.Reporter {
+		return []health.Reporter{reporterFunc(ut.tracker.Statuses)}
+	})
+
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	report := health.Report{}
+
+	ut.Require().NoError(json.Unmarshal(recorder.Body.Bytes(), &report))
+
+	return recorder, report
+}
+
+type reporterFunc func() []health.QueueStatus
+
+func (r reporterFunc) Health() []health.QueueStatus {
+	return r()
+}
+
+func (ut *UnitTest) TestTracker() {
+	ut.tracker.Discovered("queue-b")
+	ut.tracker.Discovered("queue-a")
+	ut.tracker.Received("queue-a")
+	ut.tracker.Acquire("queue-a")
+	ut.tracker.Acquire("queue-a")
+	ut.tracker.Release("queue-a")
+
+	statuses := ut.tracker.Statuses()
+
+	ut.Len(statuses, 2)
+	ut.Equal("queue-a", statuses[0].Queue)
+	ut.Equal(int64(1), statuses[0].InFlight)
+	ut.NotNil(statuses[0].LastReceiveAt)
+	ut.True(statuses[0].Healthy())
+	ut.Equal("queue-b", statuses[1].Queue)
+	ut.Nil(statuses[1].LastReceiveAt)
+	ut.True(statuses[1].Healthy())
+}
+
+func (ut *UnitTest) TestFailedAfterReceive() {
+	ut.tracker.Discovered("queue")
+	ut.tracker.Received("queue")
+	ut.tracker.Failed("queue", errors.New("receive error"))
+
+	status := ut.tracker.Statuses()[0]
+
+	ut.Equal("receive error", status.LastError)
+	ut.False(status.Healthy())
+
+	ut.tracker.Received("queue")
+
+	ut.True(ut.tracker.Statuses()[0].Healthy())
+}
+
+func (ut *UnitTest) TestHandlerHealthy() {
+	ut.tracker.Discovered("queue")
+	ut.tracker.Received("queue")
+
+	recorder, report := ut.serve()
+
+	ut.Equal(http.StatusOK, recorder.Code)
+	ut.Equal("application/json", recorder.Header().Get("Content-Type"))
+	ut.True(report.Healthy)
+	ut.Len(report.Queues, 1)
+}
+
+func (ut *UnitTest) TestHandlerDiscoveryFailed() {
+	ut.tracker.DiscoveryFailed("queue", errors.New("queue does not exist"))
+
+	recorder, report := ut.serve()
+
+	ut.Equal(http.StatusServiceUnavailable, recorder.Code)
+	ut.False(report.Healthy)
+	ut.False(report.Queues[0].DiscoverySucceeded)
+	ut.Equal("queue does not exist", report.Queues[0].LastError)
+}
+
+func (ut *UnitTest) TestHandlerWithoutQueues() {
+	recorder, report := ut.serve()
+
+	ut.Equal(http.StatusOK, recorder.Code)
+	ut.True(report.Healthy)
+	ut.Empty(report.Queues)
+}
+
+func (ut *UnitTest) TestRemove() {
+	ut.tracker.DiscoveryFailed("queue", errors.New("list error"))
+	ut.tracker.Discovered("queue-a")
+	ut.tracker.Remove("queue")
+
+	statuses := ut.tracker.Statuses()
+
+	ut.Len(statuses, 1)
+	ut.Equal("queue-a", statuses[0].Queue)
+}
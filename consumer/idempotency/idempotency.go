@@ -0,0 +1,112 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/logger"
+	"github.com/inaciogu/go-sqs/consumer/message"
+)
+
+// Store records the keys of the messages already processed
+type Store interface {
+	// Seen reports whether the key was recorded and did not expire yet
+	Seen(ctx context.Context, key string) (bool, error)
+	// Complete records the key for the given time to live
+	Complete(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// KeyFunc extracts the idempotency key of the message. It returns false when the message has no key.
+type KeyFunc func(message *message.Message) (string, bool)
+
+// DefaultTTL is how long the completions are recorded by default. It should be longer than the retention period of the queue.
+const DefaultTTL = 24 * time.Hour
+
+type Options struct {
+	Store Store
+	// Key extracts the idempotency key of the messages. Defaults to ByMessageId.
+	Key KeyFunc
+	// TTL is how long the completions are recorded. Defaults to DefaultTTL.
+	TTL    time.Duration
+	Logger consumer.Logger
+}
+
+// ByMessageId uses the SQS message ID as the key, which identifies the redeliveries of the same message
+func ByMessageId() KeyFunc {
+	return func(message *message.Message) (string, bool) {
+		return message.Metadata.MessageId, message.Metadata.MessageId != ""
+	}
+}
+
+// ByAttribute uses the value of a message attribute as the key, e.g. an ID set by the producer
+func ByAttribute(name string) KeyFunc {
+	return func(message *message.Message) (string, bool) {
+		value, ok := message.Metadata.MessageAttributes[name]
+
+		return value, ok && value != ""
+	}
+}
+
+// ByField uses a field of the JSON content as the key. See message.Field for the supported paths.
+func ByField(path string) KeyFunc {
+	return func(message *message.Message) (string, bool) {
+		return message.Field(path)
+	}
+}
+
+// New wraps handle, so messages whose key was already completed are skipped (and deleted), and the key of every handled message is recorded.
+// Messages without a key are always handled. When the store fails, the message is not handled, so it is retried later.
+func New(options Options, handle func(message *message.Message) bool) func(message *message.Message) bool {
+	if options.Store == nil {
+		panic("Store is required")
+	}
+
+	if options.Key == nil {
+		options.Key = ByMessageId()
+	}
+
+	if options.TTL == 0 {
+		options.TTL = DefaultTTL
+	}
+
+	if options.Logger == nil {
+		options.Logger = logger.New(logger.DefaultLoggerConfig{})
+	}
+
+	return func(message *message.Message) bool {
+		key, ok := options.Key(message)
+
+		if !ok {
+			return handle(message)
+		}
+
+		// The store calls are cancelled with the handling of the message, e.g. when HandlerTimeout is exceeded
+		ctx := message.Context()
+
+		seen, err := options.Store.Seen(ctx, key)
+
+		if err != nil {
+			options.Logger.Log("failed to check idempotency key %s: %s", key, err.Error())
+
+			return false
+		}
+
+		if seen {
+			options.Logger.Log("skipping message %s already processed with key %s", message.Metadata.MessageId, key)
+
+			return true
+		}
+
+		if !handle(message) {
+			return false
+		}
+
+		// The message was handled, so it is deleted even if the completion can not be recorded
+		if err := options.Store.Complete(ctx, key, options.TTL); err != nil {
+			options.Logger.Log("failed to record idempotency key %s: %s", key, err.Error())
+		}
+
+		return true
+	}
+}
@@ -0,0 +1,225 @@
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer/idempotency"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockLogger struct {
+	mock.Mock
+}
+
+func (m *MockLogger) Log(message string, v ...interface{}) {
+	m.Called(message, v)
+}
+
+type failingStore struct{}
+
+func (failingStore) Seen(ctx context.Context, key string) (bool, error) {
+	return false, errors.New("store unavailable")
+}
+
+func (failingStore) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	return errors.New("store unavailable")
+}
+
+type UnitTest struct {
+	suite.Suite
+	logger *MockLogger
+}
+
+func (u *UnitTest) SetupTest() {
+	u.logger = new(MockLogger)
+	u.logger.On("Log", mock.Anything, mock.Anything)
+}
+
+func TestUnitSuites(t *testing.T) {
+	suite.Run(t, &UnitTest{})
+}
+
+func newMessage(id string, body string) *message.Message {
+	return message.New(&sqs.Message{
+		MessageId:     aws.String(id),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(body),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"idempotencyKey": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String("key-" + id),
+			},
+		},
+	})
+}
+
+// counter returns a handler that counts its calls and returns result
+func counter(calls *int, result bool) func(message *message.Message) bool {
+	return func(message *message.Message) bool {
+		*calls++
+
+		return result
+	}
+}
+
+func (u *UnitTest) TestSkipsProcessedMessages() {
+	calls := 0
+
+	handle := idempotency.New(idempotency.Options{
+		Store:  idempotency.NewMemoryStore(),
+		Logger: u.logger,
+	}, counter(&calls, true))
+
+	u.True(handle(newMessage("id-1", `{}`)))
+	u.True(handle(newMessage("id-1", `{}`)))
+	u.True(handle(newMessage("id-2", `{}`)))
+	u.Equal(2, calls)
+}
+
+func (u *UnitTest) TestDoesNotRecordUnhandledMessages() {
+	calls := 0
+
+	handle := idempotency.New(idempotency.Options{
+		Store:  idempotency.NewMemoryStore(),
+		Logger: u.logger,
+	}, counter(&calls, false))
+
+	u.False(handle(newMessage("id-1", `{}`)))
+	u.False(handle(newMessage("id-1", `{}`)))
+	u.Equal(2, calls)
+}
+
+func (u *UnitTest) TestByAttribute() {
+	calls := 0
+
+	handle := idempotency.New(idempotency.Options{
+		Store:  idempotency.NewMemoryStore(),
+		Key:    idempotency.ByAttribute("idempotencyKey"),
+		Logger: u.logger,
+	}, counter(&calls, true))
+
+	u.True(handle(newMessage("id-1", `{}`)))
+	u.True(handle(newMessage("id-1", `{}`)))
+	u.Equal(1, calls)
+}
+
+func (u *UnitTest) TestByField() {
+	calls := 0
+
+	handle := idempotency.New(idempotency.Options{
+		Store:  idempotency.NewMemoryStore(),
+		Key:    idempotency.ByField("order.id"),
+		Logger: u.logger,
+	}, counter(&calls, true))
+
+	// Different messages carrying the same order are processed once
+	u.True(handle(newMessage("id-1", `{"order": {"id": 42}}`)))
+	u.True(handle(newMessage("id-2", `{"order": {"id": 42}}`)))
+	// Messages without a key are always processed
+	u.True(handle(newMessage("id-3", `{}`)))
+	u.True(handle(newMessage("id-3", `{}`)))
+	u.Equal(3, calls)
+}
+
+func (u *UnitTest) TestTTL() {
+	calls := 0
+
+	handle := idempotency.New(idempotency.Options{
+		Store:  idempotency.NewMemoryStore(),
+		TTL:    50 * time.Millisecond,
+		Logger: u.logger,
+	}, counter(&calls, true))
+
+	u.True(handle(newMessage("id-1", `{}`)))
+
+	time.Sleep(100 * time.Millisecond)
+
+	u.True(handle(newMessage("id-1", `{}`)))
+	u.Equal(2, calls)
+}
+
+func (u *UnitTest) TestStoreError() {
+	calls := 0
+
+	handle := idempotency.New(idempotency.Options{
+		Store:  failingStore{},
+		Logger: u.logger,
+	}, counter(&calls, true))
+
+	u.False(handle(newMessage("id-1", `{}`)))
+	u.Equal(0, calls)
+	u.logger.AssertCalled(u.T(), "Log", "failed to check idempotency key %s: %s", []interface{}{"id-1", "store unavailable"})
+}
+
+func (u *UnitTest) TestWithoutStore() {
+	u.Panics(func() {
+		idempotency.New(idempotency.Options{}, counter(new(int), true))
+	})
+}
+
+func (u *UnitTest) TestMemoryStoreRemovesExpiredKeys() {
+	store := idempotency.NewMemoryStore()
+	ctx := context.Background()
+
+	u.NoError(store.Complete(ctx, "expired", time.Millisecond))
+
+	time.Sleep(5 * time.Millisecond)
+
+	// Expired keys are removed when they are checked
+	seen, err := store.Seen(ctx, "expired")
+
+	u.NoError(err)
+	u.False(seen)
+	u.Equal(0, store.Len())
+
+	for i := 0; i < 998; i++ {
+		u.NoError(store.Complete(ctx, fmt.Sprintf("key-%d", i), time.Millisecond))
+	}
+
+	u.Equal(998, store.Len())
+
+	time.Sleep(5 * time.Millisecond)
+
+	// And periodically on completion, the 1000th one here
+	u.NoError(store.Complete(ctx, "key", time.Hour))
+	u.Equal(1, store.Len())
+}
+
+type contextKey struct{}
+
+// contextStore records the values of the contexts of its calls
+type contextStore struct {
+	values []interface{}
+}
+
+func (s *contextStore) Seen(ctx context.Context, key string) (bool, error) {
+	s.values = append(s.values, ctx.Value(contextKey{}))
+
+	return false, nil
+}
+
+func (s *contextStore) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	s.values = append(s.values, ctx.Value(contextKey{}))
+
+	return nil
+}
+
+func (u *UnitTest) TestMessageContext() {
+	store := &contextStore{}
+	calls := 0
+
+	handle := idempotency.New(idempotency.Options{Store: store, Logger: u.logger}, counter(&calls, true))
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "fake-value")
+
+	u.True(handle(newMessage("id-1", `{}`).WithContext(ctx)))
+	u.Equal([]interface{}{"fake-value", "fake-value"}, store.values)
+}
@@ -0,0 +1,69 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is the number of completions between the removals of the expired keys of MemoryStore
+const sweepInterval = 1000
+
+// MemoryStore is a Store that keeps the keys in memory. It is only suitable for a single consumer process.
+type MemoryStore struct {
+	mu          sync.Mutex
+	keys        map[string]time.Time
+	now         func() time.Time
+	completions int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys: make(map[string]time.Time),
+		now:  time.Now,
+	}
+}
+
+func (m *MemoryStore) Seen(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expiresAt, ok := m.keys[key]
+
+	if ok && !m.now().Before(expiresAt) {
+		delete(m.keys, key)
+
+		return false, nil
+	}
+
+	return ok, nil
+}
+
+func (m *MemoryStore) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.completions++
+
+	// Expired keys are removed periodically, so the store does not grow indefinitely without scanning it on every completion
+	if m.completions%sweepInterval == 0 {
+		for key, expiresAt := range m.keys {
+			if !now.Before(expiresAt) {
+				delete(m.keys, key)
+			}
+		}
+	}
+
+	m.keys[key] = now.Add(ttl)
+
+	return nil
+}
+
+// Len returns the number of keys recorded, including the expired ones that were not removed yet
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.keys)
+}
@@ -0,0 +1,43 @@
+package redisstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultPrefix is prepended to the idempotency keys by default
+const DefaultPrefix = "go-sqs:idempotency:"
+
+// Store is an idempotency.Store backed by Redis, so the completions are shared by every consumer process
+type Store struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// New returns a store that records the keys with the given prefix. An empty prefix means DefaultPrefix.
+func New(client redis.UniversalClient, prefix string) *Store {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+
+	return &Store{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (s *Store) Seen(ctx context.Context, key string) (bool, error) {
+	count, err := s.client.Exists(ctx, s.prefix+key).Result()
+
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (s *Store) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+key, 1, ttl).Err()
+}
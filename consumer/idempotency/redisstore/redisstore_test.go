@@ -0,0 +1,71 @@
+package redisstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/inaciogu/go-sqs/consumer/idempotency/redisstore"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/suite"
+)
+
+type UnitTest struct {
+	suite.Suite
+	server *miniredis.Miniredis
+	client *redis.Client
+}
+
+func (u *UnitTest) SetupTest() {
+	u.server = miniredis.RunT(u.T())
+	u.client = redis.NewClient(&redis.Options{Addr: u.server.Addr()})
+}
+
+func (u *UnitTest) TearDownTest() {
+	u.client.Close()
+}
+
+func TestUnitSuites(t *testing.T) {
+	suite.Run(t, &UnitTest{})
+}
+
+func (u *UnitTest) TestCompleteAndSeen() {
+	store := redisstore.New(u.client, "")
+	ctx := context.Background()
+
+	seen, err := store.Seen(ctx, "key-1")
+	u.NoError(err)
+	u.False(seen)
+
+	u.NoError(store.Complete(ctx, "key-1", time.Minute))
+
+	seen, err = store.Seen(ctx, "key-1")
+	u.NoError(err)
+	u.True(seen)
+
+	u.True(u.server.Exists(redisstore.DefaultPrefix + "key-1"))
+	u.Equal(time.Minute, u.server.TTL(redisstore.DefaultPrefix+"key-1"))
+}
+
+func (u *UnitTest) TestExpiration() {
+	store := redisstore.New(u.client, "orders:")
+	ctx := context.Background()
+
+	u.NoError(store.Complete(ctx, "key-1", time.Minute))
+
+	u.server.FastForward(2 * time.Minute)
+
+	seen, err := store.Seen(ctx, "key-1")
+	u.NoError(err)
+	u.False(seen)
+}
+
+func (u *UnitTest) TestError() {
+	store := redisstore.New(u.client, "")
+
+	u.server.Close()
+
+	_, err := store.Seen(context.Background(), "key-1")
+	u.Error(err)
+}
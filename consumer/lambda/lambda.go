@@ -0,0 +1,205 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/codec"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/logger"
+	"github.com/inaciogu/go-sqs/consumer/message"
+)
+
+// Handler is the signature of a Lambda function invoked by an SQS event source mapping.
+// Enable ReportBatchItemFailures on the mapping, so only the failed messages are retried.
+type Handler func(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error)
+
+type Options struct {
+	// Handle is called for every message, like the Handle option of the consumer, so the same function and middlewares can be used
+	Handle func(message *message.Message) bool
+	// HandleBatch is an alternative to Handle that receives the messages of the event at once, like the HandleBatch option of the consumer
+	HandleBatch func(ctx context.Context, messages []*message.Message) consumer.BatchResult
+	// Source tells how the bodies of the messages are delivered. Defaults to auto. See the Source option of the consumer.
+	Source message.SourceMode
+	// Codec decodes the messages without a content-type attribute in message.Unmarshal. Defaults to JSON.
+	Codec codec.Codec
+	// Encryption, SNSVerification, PayloadResolver and Validation decrypt, verify, resolve and validate the messages before they are handled,
+	// like the options of the consumer with the same names
+	Encryption      *consumer.EncryptionOptions
+	SNSVerification *consumer.SNSVerificationOptions
+	PayloadResolver consumer.PayloadResolver
+	Validation      *consumer.ValidationOptions
+	// SQSService is used by the poison actions of Validation. Defaults to a client built like the consumer does.
+	SQSService consumer.SQSService
+	Logger     consumer.Logger
+}
+
+// New returns a Lambda handler that converts the records of the event to messages like the consumer does and handles them with the options,
+// reporting the messages that were not handled or could not be decoded as batch item failures.
+// Invalid messages are reported as handled, unless they are held by the PoisonHold action, which only works when they are not deleted.
+// For FIFO queues, Handle is not called after a failure, and the remaining messages are reported as failures to keep their order.
+func New(options Options) Handler {
+	if options.Handle == nil && options.HandleBatch == nil {
+		panic("Handle or HandleBatch is required")
+	}
+
+	if options.Logger == nil {
+		options.Logger = logger.New(logger.DefaultLoggerConfig{})
+	}
+
+	client := consumer.New(options.SQSService, consumer.SQSClientOptions{
+		// The queues are given by the event source mapping, so the name is never resolved
+		QueueName:       "lambda",
+		Source:          options.Source,
+		Codec:           options.Codec,
+		Encryption:      options.Encryption,
+		SNSVerification: options.SNSVerification,
+		PayloadResolver: options.PayloadResolver,
+		Validation:      options.Validation,
+	})
+	client.Logger = options.Logger
+
+	return func(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+		response := events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}
+
+		fail := func(messageId string) {
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: messageId})
+		}
+
+		messages := []*message.Message{}
+		// Messages of a FIFO queue are not handled after a message that could not be prepared, to keep their order
+		blocked := false
+
+		for _, record := range event.Records {
+			if blocked {
+				fail(record.MessageId)
+
+				continue
+			}
+
+			msg, valid, err := client.PrepareMessage(ctx, newSQSMessage(record), queueUrl(record.EventSourceARN))
+
+			if err != nil {
+				options.Logger.Log("failed to decode message %s: %s", record.MessageId, err.Error())
+			}
+
+			// Held messages must not be deleted, the others were already dealt with by the poison action
+			if err != nil || (!valid && options.Validation.PoisonAction == consumer.PoisonHold) {
+				fail(record.MessageId)
+
+				blocked = record.Attributes[sqs.MessageSystemAttributeNameMessageGroupId] != ""
+
+				continue
+			}
+
+			if !valid {
+				continue
+			}
+
+			messages = append(messages, msg.WithContext(ctx))
+		}
+
+		if options.HandleBatch != nil {
+			if len(messages) > 0 {
+				for _, messageId := range options.HandleBatch(ctx, messages).Failed {
+					fail(messageId)
+				}
+			}
+
+			options.Logger.Log("batch of %d messages handled, %d failed", len(event.Records), len(response.BatchItemFailures))
+
+			ack(messages, response)
+
+			return response, nil
+		}
+
+		stopped := false
+
+		for _, msg := range messages {
+			if stopped {
+				fail(msg.Metadata.MessageId)
+
+				continue
+			}
+
+			if !options.Handle(msg) {
+				options.Logger.Log("failed to handle message with ID: %s", msg.Metadata.MessageId)
+
+				fail(msg.Metadata.MessageId)
+
+				stopped = msg.Metadata.GroupID() != ""
+
+				continue
+			}
+
+			options.Logger.Log("message handled ID: %s", msg.Metadata.MessageId)
+		}
+
+		ack(messages, response)
+
+		return response, nil
+	}
+}
+
+// ack calls the OnAck hooks of the messages that are not reported as failures, which Lambda deletes from the queue
+// once the function returns
+func ack(messages []*message.Message, response events.SQSEventResponse) {
+	failed := make(map[string]bool, len(response.BatchItemFailures))
+
+	for _, failure := range response.BatchItemFailures {
+		failed[failure.ItemIdentifier] = true
+	}
+
+	for _, msg := range messages {
+		if !failed[msg.Metadata.MessageId] {
+			msg.Ack()
+		}
+	}
+}
+
+// newSQSMessage converts the record to the message returned by ReceiveMessage
+func newSQSMessage(record events.SQSMessage) *sqs.Message {
+	sqsMessage := &sqs.Message{
+		MessageId:         aws.String(record.MessageId),
+		ReceiptHandle:     aws.String(record.ReceiptHandle),
+		Body:              aws.String(record.Body),
+		MD5OfBody:         aws.String(record.Md5OfBody),
+		Attributes:        map[string]*string{},
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{},
+	}
+
+	for key, value := range record.Attributes {
+		sqsMessage.Attributes[key] = aws.String(value)
+	}
+
+	for key, attribute := range record.MessageAttributes {
+		sqsMessage.MessageAttributes[key] = &sqs.MessageAttributeValue{
+			DataType:    aws.String(attribute.DataType),
+			StringValue: attribute.StringValue,
+			BinaryValue: attribute.BinaryValue,
+		}
+	}
+
+	return sqsMessage
+}
+
+// queueUrl returns the URL of the queue with the given ARN, as used by the poison actions
+func queueUrl(queueArn string) string {
+	parsed, err := arn.Parse(queueArn)
+
+	if err != nil {
+		return ""
+	}
+
+	domain := "amazonaws.com"
+
+	if parsed.Partition == "aws-cn" {
+		domain = "amazonaws.com.cn"
+	}
+
+	return fmt.Sprintf("https://sqs.%s.%s/%s/%s", parsed.Region, domain, parsed.AccountID, parsed.Resource)
+}
@@ -0,0 +1,321 @@
+package lambda_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/lambda"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/inaciogu/go-sqs/encryption"
+	"github.com/inaciogu/go-sqs/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockLogger struct {
+	mock.Mock
+}
+
+func (m *MockLogger) Log(message string, v ...interface{}) {
+	m.Called(message, v)
+}
+
+type UnitTest struct {
+	suite.Suite
+	logger *MockLogger
+}
+
+func (u *UnitTest) SetupTest() {
+	u.logger = new(MockLogger)
+	u.logger.On("Log", mock.Anything, mock.Anything)
+}
+
+func TestUnitSuites(t *testing.T) {
+	suite.Run(t, &UnitTest{})
+}
+
+func newEvent(bodies ...string) events.SQSEvent {
+	event := events.SQSEvent{}
+
+	for i, body := range bodies {
+		event.Records = append(event.Records, events.SQSMessage{
+			MessageId:      fmt.Sprintf("message-id-%d", i),
+			ReceiptHandle:  fmt.Sprintf("receipt-handle-%d", i),
+			Body:           body,
+			EventSourceARN: "arn:aws:sqs:us-east-1:123456789012:fake-queue-name",
+			Attributes: map[string]string{
+				"ApproximateReceiveCount": "2",
+			},
+			MessageAttributes: map[string]events.SQSMessageAttribute{
+				"eventType": {DataType: "String", StringValue: aws.String("order.created")},
+				"checksum":  {DataType: "Binary", BinaryValue: []byte("fake-checksum")},
+			},
+		})
+	}
+
+	return event
+}
+
+func failures(response events.SQSEventResponse) []string {
+	ids := []string{}
+
+	for _, failure := range response.BatchItemFailures {
+		ids = append(ids, failure.ItemIdentifier)
+	}
+
+	return ids
+}
+
+func (u *UnitTest) TestHandle() {
+	handled := []*message.Message{}
+
+	handler := lambda.New(lambda.Options{
+		Handle: func(message *message.Message) bool {
+			handled = append(handled, message)
+
+			return message.Content != `{"fail": true}`
+		},
+		Logger: u.logger,
+	})
+
+	response, err := handler(context.Background(), newEvent(`{"id": 1}`, `{"fail": true}`, `{"id": 2}`))
+
+	u.NoError(err)
+	u.Equal([]string{"message-id-1"}, failures(response))
+	u.Len(handled, 3)
+	u.Equal(`{"id": 1}`, handled[0].Content)
+	u.Equal("receipt-handle-0", handled[0].Metadata.ReceiptHandle)
+	u.Equal("order.created", handled[0].Metadata.MessageAttributes["eventType"])
+	u.Equal(2, handled[0].Metadata.ReceiveCount())
+}
+
+func (u *UnitTest) TestHandle_Ack() {
+	acked := []string{}
+
+	handler := lambda.New(lambda.Options{
+		Handle: func(message *message.Message) bool {
+			message.OnAck(func() {
+				acked = append(acked, message.Metadata.MessageId)
+			})
+
+			return message.Content != `{"fail": true}`
+		},
+		Logger: u.logger,
+	})
+
+	_, err := handler(context.Background(), newEvent(`{"id": 1}`, `{"fail": true}`))
+
+	u.NoError(err)
+	u.Equal([]string{"message-id-0"}, acked)
+}
+
+func (u *UnitTest) TestHandle_SNS() {
+	var content string
+
+	handler := lambda.New(lambda.Options{
+		Handle: func(message *message.Message) bool {
+			content = message.Content
+
+			return true
+		},
+		Logger: u.logger,
+	})
+
+	response, err := handler(context.Background(), newEvent(`{"Type": "Notification", "TopicArn": "arn:aws:sns:us-east-1:123456789012:topic", "Message": "fake-message"}`))
+
+	u.NoError(err)
+	u.Empty(response.BatchItemFailures)
+	u.Equal("fake-message", content)
+}
+
+type contextKey struct{}
+
+func (u *UnitTest) TestHandle_Context() {
+	ctx := context.WithValue(context.Background(), contextKey{}, "fake-value")
+
+	handler := lambda.New(lambda.Options{
+		Handle: func(message *message.Message) bool {
+			return message.Context().Value(contextKey{}) == "fake-value"
+		},
+		Logger: u.logger,
+	})
+
+	response, err := handler(ctx, newEvent(`{"id": 1}`))
+
+	u.NoError(err)
+	u.Empty(response.BatchItemFailures)
+}
+
+func (u *UnitTest) TestHandle_FIFO() {
+	calls := 0
+
+	handler := lambda.New(lambda.Options{
+		Handle: func(message *message.Message) bool {
+			calls++
+
+			return message.Content != `{"fail": true}`
+		},
+		Logger: u.logger,
+	})
+
+	event := newEvent(`{"id": 1}`, `{"fail": true}`, `{"id": 2}`)
+
+	for i := range event.Records {
+		event.Records[i].Attributes["MessageGroupId"] = "group-id"
+	}
+
+	response, err := handler(context.Background(), event)
+
+	u.NoError(err)
+	u.Equal([]string{"message-id-1", "message-id-2"}, failures(response))
+	u.Equal(2, calls)
+}
+
+func (u *UnitTest) TestHandle_UndecodableMessage() {
+	calls := 0
+
+	handler := lambda.New(lambda.Options{
+		Handle: func(message *message.Message) bool {
+			calls++
+
+			return true
+		},
+		Source: message.SourceSNS,
+		Logger: u.logger,
+	})
+
+	response, err := handler(context.Background(), newEvent(`{"id": 1}`))
+
+	u.NoError(err)
+	u.Equal([]string{"message-id-0"}, failures(response))
+	u.Equal(0, calls)
+	u.logger.AssertCalled(u.T(), "Log", "failed to decode message %s: %s", []interface{}{"message-id-0", "message message-id-0 is not an SNS notification"})
+}
+
+func (u *UnitTest) TestHandle_FIFOUndecodable() {
+	calls := 0
+
+	handler := lambda.New(lambda.Options{
+		Handle: func(message *message.Message) bool {
+			calls++
+
+			return true
+		},
+		Logger: u.logger,
+	})
+
+	event := newEvent(`{"id": 1}`, `{"id": 2}`, `{"id": 3}`)
+
+	for i := range event.Records {
+		event.Records[i].Attributes["MessageGroupId"] = "group-id"
+	}
+
+	event.Records[1].MessageAttributes["content-encoding"] = events.SQSMessageAttribute{DataType: "String", StringValue: aws.String("br")}
+
+	response, err := handler(context.Background(), event)
+
+	u.NoError(err)
+	u.Equal([]string{"message-id-1", "message-id-2"}, failures(response))
+	u.Equal(1, calls)
+}
+
+func (u *UnitTest) TestHandle_Encryption() {
+	provider, _ := encryption.NewStaticKeyProvider("fake-key-id", bytes.Repeat([]byte("k"), 32))
+	body, attributes, _ := encryption.Encrypt(context.Background(), provider, `{"email": "test@test.com"}`)
+
+	event := newEvent(body)
+
+	for key, value := range attributes {
+		event.Records[0].MessageAttributes[key] = events.SQSMessageAttribute{DataType: "String", StringValue: aws.String(value)}
+	}
+
+	var content string
+
+	handler := lambda.New(lambda.Options{
+		Handle: func(message *message.Message) bool {
+			content = message.Content
+
+			return true
+		},
+		Encryption: &consumer.EncryptionOptions{Provider: provider, Required: true},
+		Logger:     u.logger,
+	})
+
+	response, err := handler(context.Background(), event)
+
+	u.NoError(err)
+	u.Empty(response.BatchItemFailures)
+	u.Equal(`{"email": "test@test.com"}`, content)
+}
+
+func (u *UnitTest) TestHandle_Validation() {
+	mockSQSService := new(mocks.SQSService)
+
+	mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+	mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	for action, failed := range map[consumer.PoisonAction][]string{
+		consumer.PoisonHold:   {"message-id-1"},
+		consumer.PoisonDelete: {},
+	} {
+		calls := 0
+
+		handler := lambda.New(lambda.Options{
+			Handle: func(message *message.Message) bool {
+				calls++
+
+				return true
+			},
+			Validation: &consumer.ValidationOptions{
+				QueueSchemas: map[string]string{"fake-queue-name": `{"required": ["id"]}`},
+				PoisonAction: action,
+			},
+			SQSService: mockSQSService,
+			Logger:     u.logger,
+		})
+
+		response, err := handler(context.Background(), newEvent(`{"id": 1}`, `{"name": "invalid"}`))
+
+		u.NoError(err)
+		u.Equal(failed, failures(response))
+		u.Equal(1, calls)
+	}
+
+	mockSQSService.AssertCalled(u.T(), "ChangeMessageVisibility", mock.MatchedBy(func(input *sqs.ChangeMessageVisibilityInput) bool {
+		return *input.QueueUrl == "https://sqs.us-east-1.amazonaws.com/123456789012/fake-queue-name" && *input.ReceiptHandle == "receipt-handle-1"
+	}))
+	mockSQSService.AssertCalled(u.T(), "DeleteMessage", mock.MatchedBy(func(input *sqs.DeleteMessageInput) bool {
+		return *input.ReceiptHandle == "receipt-handle-1"
+	}))
+}
+
+func (u *UnitTest) TestHandleBatch() {
+	var received []*message.Message
+
+	handler := lambda.New(lambda.Options{
+		HandleBatch: func(ctx context.Context, messages []*message.Message) consumer.BatchResult {
+			received = messages
+
+			return consumer.BatchResult{Failed: []string{"message-id-2"}}
+		},
+		Logger: u.logger,
+	})
+
+	response, err := handler(context.Background(), newEvent(`{"id": 1}`, `{"id": 2}`, `{"id": 3}`))
+
+	u.NoError(err)
+	u.Equal([]string{"message-id-2"}, failures(response))
+	u.Len(received, 3)
+}
+
+func (u *UnitTest) TestNew_WithoutHandle() {
+	u.PanicsWithValue("Handle or HandleBatch is required", func() {
+		lambda.New(lambda.Options{})
+	})
+}
@@ -0,0 +1,185 @@
+package largepayload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/logger"
+	"github.com/inaciogu/go-sqs/consumer/message"
+)
+
+const (
+	// PointerClass is the first element of the pointers sent by the extended clients
+	PointerClass = "software.amazon.payloadoffloading.PayloadS3Pointer"
+	// SizeAttribute is the message attribute holding the size of the payload stored in S3
+	SizeAttribute = "ExtendedPayloadSize"
+	// LegacySizeAttribute is the size attribute used by the first versions of the extended clients
+	LegacySizeAttribute = "SQSLargePayloadSize"
+)
+
+// S3API is the subset of the S3 client used to fetch and delete the payloads
+type S3API interface {
+	GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+}
+
+// Pointer is the location of a payload stored in S3
+type Pointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+type Options struct {
+	Client S3API
+	// DeleteAfterHandle deletes the payload from S3 once the message is handled and deleted from the queue (see message.OnAck),
+	// so a message that can not be deleted is retried with its payload.
+	// Leave it disabled when the payload is shared by several queues, e.g. messages fanned out by SNS.
+	DeleteAfterHandle bool
+	Logger            consumer.Logger
+}
+
+// ParsePointer returns the S3 pointer carried by the message, if any. Both the current format
+// (["software.amazon.payloadoffloading.PayloadS3Pointer", {...}]) and the legacy one (a bare pointer object with the SQSLargePayloadSize attribute) are supported.
+func ParsePointer(message *message.Message) (Pointer, bool) {
+	pointer := Pointer{}
+	envelope := []json.RawMessage{}
+
+	if err := json.Unmarshal([]byte(message.Content), &envelope); err == nil && len(envelope) == 2 {
+		class := ""
+
+		if json.Unmarshal(envelope[0], &class) != nil || class != PointerClass {
+			return pointer, false
+		}
+
+		if json.Unmarshal(envelope[1], &pointer) != nil {
+			return pointer, false
+		}
+
+		return pointer, pointer.Bucket != "" && pointer.Key != ""
+	}
+
+	if _, ok := message.Metadata.MessageAttributes[LegacySizeAttribute]; !ok {
+		return pointer, false
+	}
+
+	if json.Unmarshal([]byte(message.Content), &pointer) != nil {
+		return pointer, false
+	}
+
+	return pointer, pointer.Bucket != "" && pointer.Key != ""
+}
+
+// New wraps handle, so messages carrying an S3 pointer are handled with the payload downloaded from S3 as their content.
+// When the payload can not be downloaded, the message is not handled, so it is retried later.
+// To validate the payloads with the Validation option of the consumer, use NewResolver instead.
+func New(options Options, handle func(message *message.Message) bool) func(message *message.Message) bool {
+	setDefaultOptions(&options)
+
+	return func(msg *message.Message) bool {
+		pointer, ok := ParsePointer(msg)
+
+		if !ok {
+			return handle(msg)
+		}
+
+		resolved := *msg
+
+		if err := resolve(options, &resolved, pointer); err != nil {
+			options.Logger.Log("failed to download payload s3://%s/%s of message %s: %s", pointer.Bucket, pointer.Key, msg.Metadata.MessageId, err.Error())
+
+			return false
+		}
+
+		return handle(&resolved)
+	}
+}
+
+// Resolver downloads the payloads in the consumer, before the messages are validated and handled. It implements consumer.PayloadResolver.
+type Resolver struct {
+	options Options
+}
+
+// NewResolver returns a resolver to set as the PayloadResolver option of the consumer, e.g. so the Validation option validates the payloads
+// instead of the S3 pointers. A message whose payload can not be downloaded is backed off like a message that can not be decoded.
+func NewResolver(options Options) *Resolver {
+	setDefaultOptions(&options)
+
+	return &Resolver{options: options}
+}
+
+// Resolve replaces the content of a message carrying an S3 pointer with the payload. Other messages are left as they are.
+func (r *Resolver) Resolve(ctx context.Context, msg *message.Message) error {
+	pointer, ok := ParsePointer(msg)
+
+	if !ok {
+		return nil
+	}
+
+	if err := resolve(r.options, msg, pointer); err != nil {
+		return fmt.Errorf("failed to download payload s3://%s/%s of message %s: %w", pointer.Bucket, pointer.Key, msg.Metadata.MessageId, err)
+	}
+
+	return nil
+}
+
+func setDefaultOptions(options *Options) {
+	if options.Client == nil {
+		panic("Client is required")
+	}
+
+	if options.Logger == nil {
+		options.Logger = logger.New(logger.DefaultLoggerConfig{})
+	}
+}
+
+// resolve sets the payload as the content of the message, registering its deletion when DeleteAfterHandle is enabled
+func resolve(options Options, msg *message.Message, pointer Pointer) error {
+	content, err := download(options.Client, pointer)
+
+	if err != nil {
+		return err
+	}
+
+	msg.Content = content
+
+	if options.DeleteAfterHandle {
+		msg.OnAck(func() {
+			_, err := options.Client.DeleteObject(&s3.DeleteObjectInput{
+				Bucket: aws.String(pointer.Bucket),
+				Key:    aws.String(pointer.Key),
+			})
+
+			if err != nil {
+				options.Logger.Log("failed to delete payload s3://%s/%s of message %s: %s", pointer.Bucket, pointer.Key, msg.Metadata.MessageId, err.Error())
+			}
+		})
+	}
+
+	return nil
+}
+
+func download(client S3API, pointer Pointer) (string, error) {
+	result, err := client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(pointer.Bucket),
+		Key:    aws.String(pointer.Key),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	defer result.Body.Close()
+
+	content, err := io.ReadAll(result.Body)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
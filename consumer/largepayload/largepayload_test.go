@@ -0,0 +1,294 @@
+package largepayload_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/largepayload"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/inaciogu/go-sqs/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockLogger struct {
+	mock.Mock
+}
+
+func (m *MockLogger) Log(message string, v ...interface{}) {
+	m.Called(message, v)
+}
+
+type UnitTest struct {
+	suite.Suite
+	mockS3 *mocks.S3API
+	logger *MockLogger
+}
+
+func (u *UnitTest) SetupTest() {
+	u.mockS3 = new(mocks.S3API)
+	u.logger = new(MockLogger)
+	u.logger.On("Log", mock.Anything, mock.Anything)
+}
+
+func TestUnitSuites(t *testing.T) {
+	suite.Run(t, &UnitTest{})
+}
+
+const pointerBody = `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"fake-bucket","s3Key":"fake-key"}]`
+
+func newMessage(body string, attributes map[string]string) *message.Message {
+	sqsMessage := &sqs.Message{
+		MessageId:         aws.String("message-id"),
+		ReceiptHandle:     aws.String("receipt-handle"),
+		Body:              aws.String(body),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{},
+	}
+
+	for key, value := range attributes {
+		sqsMessage.MessageAttributes[key] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(value),
+		}
+	}
+
+	return message.New(sqsMessage)
+}
+
+func (u *UnitTest) mockGetObject(content string) {
+	u.mockS3.On("GetObject", mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+		return *input.Bucket == "fake-bucket" && *input.Key == "fake-key"
+	})).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(content))}, nil)
+}
+
+func (u *UnitTest) TestParsePointer() {
+	pointer, ok := largepayload.ParsePointer(newMessage(pointerBody, map[string]string{largepayload.SizeAttribute: "300000"}))
+
+	u.True(ok)
+	u.Equal(largepayload.Pointer{Bucket: "fake-bucket", Key: "fake-key"}, pointer)
+
+	pointer, ok = largepayload.ParsePointer(newMessage(`{"s3BucketName":"fake-bucket","s3Key":"fake-key"}`, map[string]string{largepayload.LegacySizeAttribute: "300000"}))
+
+	u.True(ok)
+	u.Equal(largepayload.Pointer{Bucket: "fake-bucket", Key: "fake-key"}, pointer)
+
+	_, ok = largepayload.ParsePointer(newMessage(`{"s3BucketName":"fake-bucket","s3Key":"fake-key"}`, nil))
+	u.False(ok)
+
+	_, ok = largepayload.ParsePointer(newMessage(`["other", {"s3BucketName":"fake-bucket","s3Key":"fake-key"}]`, nil))
+	u.False(ok)
+
+	_, ok = largepayload.ParsePointer(newMessage(`{"content": "fake-content"}`, nil))
+	u.False(ok)
+}
+
+func (u *UnitTest) TestDownloadsPayload() {
+	u.mockGetObject(`{"content": "large-content"}`)
+
+	contents := []string{}
+
+	handle := largepayload.New(largepayload.Options{Client: u.mockS3, Logger: u.logger}, func(message *message.Message) bool {
+		contents = append(contents, message.Content)
+
+		return true
+	})
+
+	u.True(handle(newMessage(pointerBody, nil)))
+	u.True(handle(newMessage(`{"content": "small-content"}`, nil)))
+
+	u.Equal([]string{`{"content": "large-content"}`, `{"content": "small-content"}`}, contents)
+	u.mockS3.AssertNumberOfCalls(u.T(), "GetObject", 1)
+	u.mockS3.AssertNotCalled(u.T(), "DeleteObject", mock.Anything)
+}
+
+func (u *UnitTest) TestDownloadsPayload_SNS() {
+	u.mockGetObject(`{"content": "large-content"}`)
+
+	handle := largepayload.New(largepayload.Options{Client: u.mockS3, Logger: u.logger}, func(message *message.Message) bool {
+		return message.Content == `{"content": "large-content"}`
+	})
+
+	body := `{"Type": "Notification", "TopicArn": "arn:aws:sns:us-east-1:123456789012:topic", "Message": "[\"software.amazon.payloadoffloading.PayloadS3Pointer\",{\"s3BucketName\":\"fake-bucket\",\"s3Key\":\"fake-key\"}]"}`
+
+	u.True(handle(newMessage(body, nil)))
+}
+
+func (u *UnitTest) TestDeleteAfterHandle() {
+	u.mockGetObject(`{"content": "large-content"}`)
+	u.mockS3.On("DeleteObject", mock.MatchedBy(func(input *s3.DeleteObjectInput) bool {
+		return *input.Bucket == "fake-bucket" && *input.Key == "fake-key"
+	})).Return(&s3.DeleteObjectOutput{}, nil)
+
+	handle := largepayload.New(largepayload.Options{Client: u.mockS3, DeleteAfterHandle: true, Logger: u.logger}, func(message *message.Message) bool {
+		return true
+	})
+
+	msg := newMessage(pointerBody, nil)
+
+	u.True(handle(msg))
+
+	// The payload is only deleted once the message is deleted from the queue
+	u.mockS3.AssertNotCalled(u.T(), "DeleteObject", mock.Anything)
+
+	msg.Ack()
+
+	u.mockS3.AssertNumberOfCalls(u.T(), "DeleteObject", 1)
+}
+
+func (u *UnitTest) TestDeleteAfterHandle_NotHandled() {
+	u.mockGetObject(`{"content": "large-content"}`)
+
+	handle := largepayload.New(largepayload.Options{Client: u.mockS3, DeleteAfterHandle: true, Logger: u.logger}, func(message *message.Message) bool {
+		return false
+	})
+
+	u.False(handle(newMessage(pointerBody, nil)))
+	u.mockS3.AssertNotCalled(u.T(), "DeleteObject", mock.Anything)
+}
+
+func (u *UnitTest) TestDownloadError() {
+	u.mockS3.On("GetObject", mock.Anything).Return(nil, errors.New("NoSuchKey"))
+
+	calls := 0
+
+	handle := largepayload.New(largepayload.Options{Client: u.mockS3, Logger: u.logger}, func(message *message.Message) bool {
+		calls++
+
+		return true
+	})
+
+	u.False(handle(newMessage(pointerBody, nil)))
+	u.Equal(0, calls)
+	u.logger.AssertCalled(u.T(), "Log", "failed to download payload s3://%s/%s of message %s: %s", []interface{}{"fake-bucket", "fake-key", "message-id", "NoSuchKey"})
+}
+
+func (u *UnitTest) TestWithoutClient() {
+	u.Panics(func() {
+		largepayload.New(largepayload.Options{}, func(message *message.Message) bool {
+			return true
+		})
+	})
+}
+
+func (u *UnitTest) TestResolver() {
+	u.mockGetObject(`{"content": "large-content"}`)
+
+	resolver := largepayload.NewResolver(largepayload.Options{Client: u.mockS3, Logger: u.logger})
+
+	msg := newMessage(pointerBody, nil)
+
+	u.NoError(resolver.Resolve(context.Background(), msg))
+	u.Equal(`{"content": "large-content"}`, msg.Content)
+
+	msg = newMessage(`{"content": "small-content"}`, nil)
+
+	u.NoError(resolver.Resolve(context.Background(), msg))
+	u.Equal(`{"content": "small-content"}`, msg.Content)
+	u.mockS3.AssertNumberOfCalls(u.T(), "GetObject", 1)
+}
+
+func (u *UnitTest) TestResolver_DownloadError() {
+	u.mockS3.On("GetObject", mock.Anything).Return(nil, errors.New("NoSuchKey"))
+
+	resolver := largepayload.NewResolver(largepayload.Options{Client: u.mockS3, Logger: u.logger})
+
+	err := resolver.Resolve(context.Background(), newMessage(pointerBody, nil))
+
+	u.EqualError(err, "failed to download payload s3://fake-bucket/fake-key of message message-id: NoSuchKey")
+}
+
+const orderSchema = `{
+	"type": "object",
+	"properties": {
+		"id": {"type": "integer"}
+	},
+	"required": ["id"]
+}`
+
+// newValidatingClient returns a consumer resolving the payloads with the resolver before validating them, which deletes the invalid messages
+func (u *UnitTest) newValidatingClient(sqsService *mocks.SQSService, resolver *largepayload.Resolver, contents *[]string) *consumer.SQSClient {
+	return consumer.New(sqsService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			*contents = append(*contents, message.Content)
+
+			return true
+		},
+		PayloadResolver: resolver,
+		Validation: &consumer.ValidationOptions{
+			QueueSchemas: map[string]string{"fake-queue-name": orderSchema},
+			PoisonAction: consumer.PoisonDelete,
+		},
+	})
+}
+
+func newSQSMessage(body string) *sqs.Message {
+	return &sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(body),
+	}
+}
+
+func (u *UnitTest) TestResolver_Validation() {
+	u.mockGetObject(`{"id": 1}`)
+	u.mockS3.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil)
+
+	sqsService := new(mocks.SQSService)
+	sqsService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	contents := []string{}
+	resolver := largepayload.NewResolver(largepayload.Options{Client: u.mockS3, DeleteAfterHandle: true, Logger: u.logger})
+	client := u.newValidatingClient(sqsService, resolver, &contents)
+
+	client.ProcessMessage(newSQSMessage(pointerBody), "https://fake-queue-url/fake-queue-name")
+
+	u.Equal([]string{`{"id": 1}`}, contents)
+	sqsService.AssertNumberOfCalls(u.T(), "DeleteMessage", 1)
+	u.mockS3.AssertNumberOfCalls(u.T(), "DeleteObject", 1)
+}
+
+func (u *UnitTest) TestResolver_ValidationInvalidPayload() {
+	u.mockGetObject(`{"id": "fake-id"}`)
+
+	sqsService := new(mocks.SQSService)
+	sqsService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	contents := []string{}
+	resolver := largepayload.NewResolver(largepayload.Options{Client: u.mockS3, DeleteAfterHandle: true, Logger: u.logger})
+	client := u.newValidatingClient(sqsService, resolver, &contents)
+
+	client.ProcessMessage(newSQSMessage(pointerBody), "https://fake-queue-url/fake-queue-name")
+
+	// The invalid message is deleted by the poison action, but its payload is kept since the message was not handled
+	u.Empty(contents)
+	sqsService.AssertNumberOfCalls(u.T(), "DeleteMessage", 1)
+	u.mockS3.AssertNotCalled(u.T(), "DeleteObject", mock.Anything)
+}
+
+func (u *UnitTest) TestResolver_ValidationDownloadError() {
+	u.mockS3.On("GetObject", mock.Anything).Return(nil, errors.New("NoSuchKey"))
+
+	sqsService := new(mocks.SQSService)
+	sqsService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	contents := []string{}
+	resolver := largepayload.NewResolver(largepayload.Options{Client: u.mockS3, Logger: u.logger})
+	client := u.newValidatingClient(sqsService, resolver, &contents)
+
+	// A payload that can not be downloaded is retried later, instead of being validated and deleted as a poison message
+	u.PanicsWithError("failed to download payload s3://fake-bucket/fake-key of message message-id: NoSuchKey", func() {
+		client.ProcessMessage(newSQSMessage(pointerBody), "https://fake-queue-url/fake-queue-name")
+	})
+
+	u.Empty(contents)
+	sqsService.AssertNumberOfCalls(u.T(), "ChangeMessageVisibility", 1)
+	sqsService.AssertNotCalled(u.T(), "DeleteMessage", mock.Anything)
+}
@@ -0,0 +1,133 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// EventBridgeEvent is an event delivered to SQS by an EventBridge rule
+type EventBridgeEvent struct {
+	Version    string    `json:"version"`
+	Id         string    `json:"id"`
+	DetailType string    `json:"detail-type"`
+	Source     string    `json:"source"`
+	Account    string    `json:"account"`
+	Time       time.Time `json:"time"`
+	Region     string    `json:"region"`
+	Resources  []string  `json:"resources"`
+	// Detail is the raw JSON of the event payload. Use UnmarshalDetail to decode it.
+	Detail json.RawMessage `json:"detail"`
+}
+
+// UnmarshalDetail decodes the detail of the event into v
+func (e *EventBridgeEvent) UnmarshalDetail(v interface{}) error {
+	return json.Unmarshal(e.Detail, v)
+}
+
+// S3Record is a record of an S3 event notification
+type S3Record struct {
+	EventVersion string    `json:"eventVersion"`
+	EventSource  string    `json:"eventSource"`
+	AwsRegion    string    `json:"awsRegion"`
+	EventTime    time.Time `json:"eventTime"`
+	EventName    string    `json:"eventName"`
+	S3           S3Entity  `json:"s3"`
+}
+
+type S3Entity struct {
+	ConfigurationId string   `json:"configurationId"`
+	Bucket          S3Bucket `json:"bucket"`
+	Object          S3Object `json:"object"`
+}
+
+type S3Bucket struct {
+	Name string `json:"name"`
+	Arn  string `json:"arn"`
+}
+
+type S3Object struct {
+	// Key is URL-encoded, as sent by S3. Use DecodedKey to get the key of the object.
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+	ETag      string `json:"eTag"`
+	VersionId string `json:"versionId"`
+	Sequencer string `json:"sequencer"`
+}
+
+// DecodedKey returns the key of the object, which S3 URL-encodes in notifications
+func (o S3Object) DecodedKey() (string, error) {
+	return url.QueryUnescape(o.Key)
+}
+
+type s3Event struct {
+	Records []S3Record `json:"Records"`
+}
+
+// EventBridge decodes the content of a message whose Source is EventBridge.
+// Events published to SNS by EventBridge are supported as well.
+func (m *Message) EventBridge() (*EventBridgeEvent, error) {
+	event := &EventBridgeEvent{}
+
+	if err := json.Unmarshal([]byte(m.Content), event); err != nil {
+		return nil, fmt.Errorf("failed to decode EventBridge event of message %s: %w", m.Metadata.MessageId, err)
+	}
+
+	if !event.valid() {
+		return nil, fmt.Errorf("message %s is not an EventBridge event", m.Metadata.MessageId)
+	}
+
+	return event, nil
+}
+
+// S3Records decodes the records of a message whose Source is S3.
+// Notifications published to SNS by S3 are supported as well.
+func (m *Message) S3Records() ([]S3Record, error) {
+	event := &s3Event{}
+
+	if err := json.Unmarshal([]byte(m.Content), event); err != nil {
+		return nil, fmt.Errorf("failed to decode S3 event of message %s: %w", m.Metadata.MessageId, err)
+	}
+
+	if !event.valid() {
+		return nil, fmt.Errorf("message %s is not an S3 event notification", m.Metadata.MessageId)
+	}
+
+	return event.Records, nil
+}
+
+func (e *EventBridgeEvent) valid() bool {
+	return e.DetailType != "" && e.Source != "" && len(e.Detail) > 0
+}
+
+func (e *s3Event) valid() bool {
+	if len(e.Records) == 0 {
+		return false
+	}
+
+	for _, record := range e.Records {
+		if record.EventSource != "aws:s3" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getEventSource returns the source of the events delivered straight to SQS, or SQS for any other content
+func getEventSource(content string) string {
+	eventBridgeEvent := EventBridgeEvent{}
+
+	if err := json.Unmarshal([]byte(content), &eventBridgeEvent); err == nil && eventBridgeEvent.valid() {
+		return EventBridge
+	}
+
+	event := s3Event{}
+
+	if err := json.Unmarshal([]byte(content), &event); err == nil && event.valid() {
+		return S3
+	}
+
+	return SQS
+}
@@ -0,0 +1,123 @@
+package message_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer/message"
+)
+
+const eventBridgeEvent = `{
+	"version": "0",
+	"id": "event-id",
+	"detail-type": "Order Created",
+	"source": "com.example.orders",
+	"account": "123456789012",
+	"time": "2023-10-01T12:00:00Z",
+	"region": "us-east-1",
+	"resources": [],
+	"detail": {"orderId": "123"}
+}`
+
+const s3Notification = `{
+	"Records": [
+		{
+			"eventVersion": "2.1",
+			"eventSource": "aws:s3",
+			"awsRegion": "us-east-1",
+			"eventTime": "2023-10-01T12:00:00.000Z",
+			"eventName": "ObjectCreated:Put",
+			"s3": {
+				"configurationId": "orders",
+				"bucket": {"name": "fake-bucket", "arn": "arn:aws:s3:::fake-bucket"},
+				"object": {"key": "orders/order+123%3A1.json", "size": 1024, "eTag": "fake-etag", "sequencer": "0A1B2C3D4E5F678901"}
+			}
+		}
+	]
+}`
+
+func newEventMessage(body string) *message.Message {
+	return message.New(&sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(body),
+	})
+}
+
+func (u *UnitTest) TestSource() {
+	snsBody, _ := json.Marshal(map[string]string{
+		"Type":     "Notification",
+		"Message":  s3Notification,
+		"TopicArn": "arn:aws:sns:us-east-1:123456789012:topic",
+	})
+
+	u.Equal(message.SQS, newEventMessage(`{"content": "fake-content"}`).Source)
+	u.Equal(message.SQS, newEventMessage(`not json`).Source)
+	u.Equal(message.SNS, newEventMessage(string(snsBody)).Source)
+	u.Equal(message.EventBridge, newEventMessage(eventBridgeEvent).Source)
+	u.Equal(message.S3, newEventMessage(s3Notification).Source)
+	u.Equal(message.SQS, newEventMessage(`{"Service": "Amazon S3", "Event": "s3:TestEvent"}`).Source)
+}
+
+func (u *UnitTest) TestEventBridge() {
+	event, err := newEventMessage(eventBridgeEvent).EventBridge()
+
+	u.NoError(err)
+	u.Equal("event-id", event.Id)
+	u.Equal("Order Created", event.DetailType)
+	u.Equal("com.example.orders", event.Source)
+	u.Equal(time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC), event.Time)
+
+	var detail struct {
+		OrderId string `json:"orderId"`
+	}
+
+	u.NoError(event.UnmarshalDetail(&detail))
+	u.Equal("123", detail.OrderId)
+}
+
+func (u *UnitTest) TestEventBridgeWithOtherSource() {
+	_, err := newEventMessage(s3Notification).EventBridge()
+
+	u.EqualError(err, "message message-id is not an EventBridge event")
+
+	_, err = newEventMessage(`not json`).EventBridge()
+
+	u.ErrorContains(err, "failed to decode EventBridge event of message message-id")
+}
+
+func (u *UnitTest) TestS3Records() {
+	records, err := newEventMessage(s3Notification).S3Records()
+
+	u.NoError(err)
+	u.Len(records, 1)
+	u.Equal("ObjectCreated:Put", records[0].EventName)
+	u.Equal("fake-bucket", records[0].S3.Bucket.Name)
+	u.Equal(int64(1024), records[0].S3.Object.Size)
+
+	key, err := records[0].S3.Object.DecodedKey()
+
+	u.NoError(err)
+	u.Equal("orders/order 123:1.json", key)
+}
+
+func (u *UnitTest) TestS3RecordsFromSNS() {
+	snsBody, _ := json.Marshal(map[string]string{
+		"Type":     "Notification",
+		"Message":  s3Notification,
+		"TopicArn": "arn:aws:sns:us-east-1:123456789012:topic",
+	})
+
+	records, err := newEventMessage(string(snsBody)).S3Records()
+
+	u.NoError(err)
+	u.Len(records, 1)
+}
+
+func (u *UnitTest) TestS3RecordsWithOtherSource() {
+	_, err := newEventMessage(eventBridgeEvent).S3Records()
+
+	u.EqualError(err, "message message-id is not an S3 event notification")
+}
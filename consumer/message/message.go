@@ -1,8 +1,18 @@
 package message
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/codec"
+	"github.com/inaciogu/go-sqs/compression"
+	"github.com/inaciogu/go-sqs/encryption"
 )
 
 type MessageAttributes map[string]Attribute
@@ -13,103 +23,372 @@ type Attribute struct {
 }
 
 type MessageMetadata struct {
-	MessageId         string
-	ReceiptHandle     string
+	MessageId     string
+	ReceiptHandle string
+	// Attributes holds the system attributes of SQS, e.g. ApproximateReceiveCount. See the typed accessors of MessageMetadata.
+	Attributes map[string]string
+	// MessageAttributes holds the attributes set by the producer, or by the publisher of the SNS notification
 	MessageAttributes map[string]string
+	// TopicArn is the ARN of the SNS topic the message was published to. It is empty for messages sent directly to SQS.
+	TopicArn string
+	// SNS is the notification the message was delivered in. It is nil for messages sent directly to SQS.
+	SNS *SNSMessageBody
+}
+
+// ReceiveCount returns the number of times the message was received, including this one
+func (m MessageMetadata) ReceiveCount() int {
+	count, _ := strconv.Atoi(m.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount])
+
+	return count
+}
+
+// SentAt returns the time the message was sent to the queue. It is zero when the attribute was not received.
+func (m MessageMetadata) SentAt() time.Time {
+	return m.timestampAttribute(sqs.MessageSystemAttributeNameSentTimestamp)
+}
+
+// FirstReceivedAt returns the time the message was first received from the queue. It is zero when the attribute was not received.
+func (m MessageMetadata) FirstReceivedAt() time.Time {
+	return m.timestampAttribute(sqs.MessageSystemAttributeNameApproximateFirstReceiveTimestamp)
+}
+
+// GroupID returns the message group ID of a message of a FIFO queue
+func (m MessageMetadata) GroupID() string {
+	return m.Attributes[sqs.MessageSystemAttributeNameMessageGroupId]
+}
+
+// DeduplicationID returns the deduplication ID of a message of a FIFO queue
+func (m MessageMetadata) DeduplicationID() string {
+	return m.Attributes[sqs.MessageSystemAttributeNameMessageDeduplicationId]
+}
+
+// SequenceNumber returns the sequence number SQS assigned to a message of a FIFO queue
+func (m MessageMetadata) SequenceNumber() string {
+	return m.Attributes[sqs.MessageSystemAttributeNameSequenceNumber]
 }
 
+// timestampAttribute parses a system attribute holding an epoch time in milliseconds
+func (m MessageMetadata) timestampAttribute(name string) time.Time {
+	milliseconds, err := strconv.ParseInt(m.Attributes[name], 10, 64)
+
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(milliseconds)
+}
+
+// SNSMessageBody is the notification of SNS, as delivered to SQS when raw message delivery is disabled
 type SNSMessageBody struct {
+	Type      string
+	MessageId string
+	TopicArn  string
+	Subject   string
+	Message   string
+	// Timestamp is the time the notification was published, in ISO 8601 format. It is kept as sent, since it is part of the signature.
+	Timestamp         string
+	SignatureVersion  string
+	Signature         string
+	SigningCertURL    string
+	UnsubscribeURL    string
 	MessageAttributes MessageAttributes
-	Message           string
 }
 
 type Message struct {
 	Content  string
 	Metadata MessageMetadata
+	// RawBody is the body of the message as received from SQS, before unwrapping, decompression and decryption
+	RawBody string
+	// Source is the envelope of the message: SQS, SNS, EventBridge or S3. See EventBridge and S3Records to read the last two.
+	Source string
+	// Codec is used by Unmarshal when the message has no content-type attribute. Defaults to JSON.
+	Codec codec.Codec
+
+	ctx  context.Context
+	acks *ackHooks
+}
+
+// ackHooks are the functions called once the message is deleted from the queue. They are shared by the copies of the message.
+type ackHooks struct {
+	mu    sync.Mutex
+	hooks []func()
+	acked bool
+}
+
+// Context returns the context of the handling of the message. The consumer only cancels it when HandlerTimeout is exceeded,
+// so the handlers run to completion when the consumer stops.
+// It defaults to context.Background().
+func (m *Message) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+
+	return m.ctx
+}
+
+// WithContext returns a shallow copy of the message with its context changed to ctx
+func (m *Message) WithContext(ctx context.Context) *Message {
+	message := *m
+	message.ctx = ctx
+
+	return &message
+}
+
+// OnAck registers a function called once the message is deleted from the queue, after it was handled.
+// It is not called when the message is not handled or can not be deleted, so the message is retried with everything it needs.
+func (m *Message) OnAck(hook func()) {
+	if m.acks == nil {
+		m.acks = &ackHooks{}
+	}
+
+	m.acks.mu.Lock()
+	defer m.acks.mu.Unlock()
+
+	m.acks.hooks = append(m.acks.hooks, hook)
+}
+
+// Ack calls the functions registered with OnAck, once. It is called by the consumer after deleting the message.
+func (m *Message) Ack() {
+	if m.acks == nil {
+		return
+	}
+
+	m.acks.mu.Lock()
+
+	if m.acks.acked {
+		m.acks.mu.Unlock()
+
+		return
+	}
+
+	m.acks.acked = true
+	hooks := m.acks.hooks
+	m.acks.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
 }
 
 const (
-	SQS = "SQS"
-	SNS = "SNS"
+	SQS         = "SQS"
+	SNS         = "SNS"
+	EventBridge = "EventBridge"
+	S3          = "S3"
 )
 
+// SourceMode tells how the body of the received messages is delivered
+type SourceMode string
+
+const (
+	// SourceAuto unwraps the bodies that are SNS notifications, i.e. JSON objects with the Notification type and a TopicArn
+	SourceAuto SourceMode = "auto"
+	// SourceRaw never unwraps the bodies, for queues fed directly or by SNS with raw message delivery
+	SourceRaw SourceMode = "raw"
+	// SourceSNS unwraps every body, rejecting the ones that are not SNS notifications
+	SourceSNS SourceMode = "sns"
+)
+
+// New converts the SQS message. When the content can not be decompressed, it is left as received; use Parse to get the error.
 func New(sqsMessage *sqs.Message) *Message {
-	content := getContent(sqsMessage)
-	metadata := MessageMetadata{
-		MessageId:         *sqsMessage.MessageId,
-		ReceiptHandle:     *sqsMessage.ReceiptHandle,
-		MessageAttributes: getMessageAttributes(sqsMessage),
+	message, _ := Parse(sqsMessage)
+
+	return message
+}
+
+// Parse converts the SQS message, decompressing its content when it has a content-encoding attribute, unless it is encrypted.
+// It returns an error, along with the message as received, when the encoding is unknown or the content is corrupted.
+func Parse(sqsMessage *sqs.Message) (*Message, error) {
+	return ParseWithSource(sqsMessage, SourceAuto)
+}
+
+// ParseWithSource converts the SQS message like Parse, unwrapping its body according to source.
+// With SourceSNS, it returns an error, along with the message as received, when the body is not an SNS notification.
+func ParseWithSource(sqsMessage *sqs.Message, source SourceMode) (*Message, error) {
+	snsBody := getSNSMessageBody(sqsMessage, source)
+
+	message := &Message{
+		Content: *sqsMessage.Body,
+		RawBody: *sqsMessage.Body,
+		Metadata: MessageMetadata{
+			MessageId:         *sqsMessage.MessageId,
+			ReceiptHandle:     *sqsMessage.ReceiptHandle,
+			Attributes:        getSystemAttributes(sqsMessage),
+			MessageAttributes: getMessageAttributes(sqsMessage),
+		},
+		Source: SQS,
+		acks:   &ackHooks{},
 	}
 
-	return &Message{
-		Content:  content,
-		Metadata: metadata,
+	if snsBody != nil {
+		message.Content = snsBody.Message
+		message.Source = SNS
+		message.Metadata.TopicArn = snsBody.TopicArn
+		message.Metadata.SNS = snsBody
+		message.Metadata.MessageAttributes = make(map[string]string)
+
+		for key, attribute := range snsBody.MessageAttributes {
+			message.Metadata.MessageAttributes[key] = attribute.Value
+		}
+	} else if source == SourceSNS {
+		return message, fmt.Errorf("message %s is not an SNS notification", message.Metadata.MessageId)
+	}
+
+	// Encrypted contents are decompressed once decrypted
+	if encryption.Encrypted(message.Metadata.MessageAttributes) {
+		return message, nil
 	}
-}
 
-func getMessageSource(sqsMessage *sqs.Message) string {
-	snsBody := SNSMessageBody{}
+	return message, message.decompress()
+}
 
-	err := json.Unmarshal([]byte(*sqsMessage.Body), &snsBody)
+// Decrypt decrypts the content of an encrypted message with the provider, then decompresses it.
+// It returns an error, leaving the content as is, when the message can not be decrypted.
+func (m *Message) Decrypt(ctx context.Context, provider encryption.KeyProvider) error {
+	content, err := encryption.Decrypt(ctx, provider, m.Content, m.Metadata.MessageAttributes)
 
 	if err != nil {
-		return SQS
+		return fmt.Errorf("failed to decrypt content of message %s: %w", m.Metadata.MessageId, err)
 	}
 
-	if snsBody.Message != "" {
-		return SNS
+	m.Content = content
+
+	return m.decompress()
+}
+
+func (m *Message) decompress() error {
+	encoding, ok := m.Metadata.MessageAttributes[compression.EncodingAttribute]
+
+	if ok {
+		content, err := compression.Decode(encoding, m.Content)
+
+		if err != nil {
+			return fmt.Errorf("failed to decode content of message %s: %w", m.Metadata.MessageId, err)
+		}
+
+		m.Content = content
+	}
+
+	// Events are detected once the content is decoded
+	if m.Source == SQS {
+		m.Source = getEventSource(m.Content)
 	}
 
-	return SQS
+	return nil
 }
 
-func getContent(sqsMessage *sqs.Message) string {
-	messageSource := getMessageSource(sqsMessage)
+// getSNSMessageBody returns the SNS notification the body is, or nil when it is not one or the source is raw
+func getSNSMessageBody(sqsMessage *sqs.Message, source SourceMode) *SNSMessageBody {
+	if source == SourceRaw {
+		return nil
+	}
 
-	if messageSource == SNS {
-		snsBody := SNSMessageBody{}
+	snsBody := &SNSMessageBody{}
 
-		json.Unmarshal([]byte(*sqsMessage.Body), &snsBody)
+	if err := json.Unmarshal([]byte(*sqsMessage.Body), snsBody); err != nil {
+		return nil
+	}
 
-		return snsBody.Message
+	if snsBody.Type != "Notification" || snsBody.TopicArn == "" {
+		return nil
 	}
 
-	return *sqsMessage.Body
+	return snsBody
 }
 
-func getMessageAttributes(message *sqs.Message) map[string]string {
+func getSystemAttributes(message *sqs.Message) map[string]string {
 	attributes := make(map[string]string)
-	messageSource := getMessageSource(message)
 
 	for key, value := range message.Attributes {
 		attributes[key] = *value
 	}
 
-	if messageSource == SQS {
-		for key, value := range message.MessageAttributes {
+	return attributes
+}
+
+func getMessageAttributes(message *sqs.Message) map[string]string {
+	attributes := make(map[string]string)
+
+	// Binary attributes have no string value
+	for key, value := range message.MessageAttributes {
+		if value.StringValue != nil {
 			attributes[key] = *value.StringValue
 		}
+	}
+
+	return attributes
+}
 
-		return attributes
+// Unmarshal decodes the content into v with the codec of its content-type attribute, or with the Codec of the message when there is none
+func (m *Message) Unmarshal(v interface{}) error {
+	messageCodec, err := m.ContentCodec()
+
+	if err != nil {
+		return err
 	}
 
-	var messageBody SNSMessageBody
+	return codec.Decode(messageCodec, m.Content, v)
+}
+
+// ContentCodec returns the codec of the content-type attribute, or the Codec of the message when there is none.
+// It returns an error when the content type has no registered codec.
+func (m *Message) ContentCodec() (codec.Codec, error) {
+	if contentType, ok := m.Metadata.MessageAttributes[codec.ContentTypeAttribute]; ok {
+		messageCodec, ok := codec.Get(contentType)
 
-	json.Unmarshal([]byte(*message.Body), &messageBody)
+		if !ok {
+			return nil, fmt.Errorf("unknown content type %s", contentType)
+		}
 
-	for key, attribute := range messageBody.MessageAttributes {
-		attributes[key] = attribute.Value
+		return messageCodec, nil
 	}
 
-	return attributes
+	if m.Codec != nil {
+		return m.Codec, nil
+	}
+
+	return codec.JSON, nil
 }
 
-func (m *Message) Unmarshal(v interface{}) error {
-	err := json.Unmarshal([]byte(m.Content), v)
+// Field returns the value found at the path of the JSON content as a string.
+// The path is a dot-separated list of object keys and array indexes, e.g. "detail.items.0.type", optionally prefixed by "$.".
+// It returns false when the content is not JSON or the path does not lead to a string, number or boolean.
+func (m *Message) Field(path string) (string, bool) {
+	var value interface{}
 
-	if err != nil {
-		return err
+	if err := json.Unmarshal([]byte(m.Content), &value); err != nil {
+		return "", false
 	}
 
-	return nil
+	for _, key := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+
+			if !ok {
+				return "", false
+			}
+
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+
+			if err != nil || index < 0 || index >= len(node) {
+				return "", false
+			}
+
+			value = node[index]
+		default:
+			return "", false
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case float64, bool:
+		return fmt.Sprint(value), true
+	default:
+		return "", false
+	}
 }
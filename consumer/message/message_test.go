@@ -1,10 +1,14 @@
 package message_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/codec"
+	"github.com/inaciogu/go-sqs/compression"
 	"github.com/inaciogu/go-sqs/consumer/message"
 	"github.com/stretchr/testify/suite"
 )
@@ -46,7 +50,9 @@ func (u *UnitTest) TestSNSMessage() {
 		},
 		Body: aws.String(`
 			{
+				"Type": "Notification",
 				"Message": "{\n  \"asda\": \"asdas\"\n}",
+				"TopicArn": "arn:aws:sns:us-east-1:123456789012:topic",
 				"MessageAttributes": {
 					"attribute1": {
 						"Type": "String",
@@ -62,9 +68,108 @@ func (u *UnitTest) TestSNSMessage() {
 	u.Equal("message-id", message.Metadata.MessageId)
 	u.Equal("receipt-handle", message.Metadata.ReceiptHandle)
 	u.Equal("{\n  \"asda\": \"asdas\"\n}", message.Content)
-	u.Equal(2, len(message.Metadata.MessageAttributes))
+	u.Equal(1, len(message.Metadata.MessageAttributes))
 	u.Equal("value1", message.Metadata.MessageAttributes["attribute1"])
-	u.Equal("1", message.Metadata.MessageAttributes["ApproximateReceiveCount"])
+	u.Equal("1", message.Metadata.Attributes["ApproximateReceiveCount"])
+	u.Equal("arn:aws:sns:us-east-1:123456789012:topic", message.Metadata.TopicArn)
+}
+
+func (u *UnitTest) TestSystemAttributes() {
+	sqsMessage := sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(`{"content": "fake-content"}`),
+		Attributes: map[string]*string{
+			"ApproximateReceiveCount":          aws.String("3"),
+			"SentTimestamp":                    aws.String("1696161600000"),
+			"ApproximateFirstReceiveTimestamp": aws.String("1696161601500"),
+			"MessageGroupId":                   aws.String("group-id"),
+			"MessageDeduplicationId":           aws.String("deduplication-id"),
+			"SequenceNumber":                   aws.String("18849496460467696128"),
+		},
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"ApproximateReceiveCount": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String("100"),
+			},
+		},
+	}
+
+	metadata := message.New(&sqsMessage).Metadata
+
+	u.Equal(3, metadata.ReceiveCount())
+	u.Equal("100", metadata.MessageAttributes["ApproximateReceiveCount"])
+	u.True(time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC).Equal(metadata.SentAt()))
+	u.True(time.Date(2023, 10, 1, 12, 0, 1, 500000000, time.UTC).Equal(metadata.FirstReceivedAt()))
+	u.Equal("group-id", metadata.GroupID())
+	u.Equal("deduplication-id", metadata.DeduplicationID())
+	u.Equal("18849496460467696128", metadata.SequenceNumber())
+}
+
+func (u *UnitTest) TestSystemAttributesMissing() {
+	metadata := message.New(&sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(`{"content": "fake-content"}`),
+	}).Metadata
+
+	u.Equal(0, metadata.ReceiveCount())
+	u.True(metadata.SentAt().IsZero())
+	u.True(metadata.FirstReceivedAt().IsZero())
+	u.Empty(metadata.GroupID())
+}
+
+func (u *UnitTest) TestSQSMessageWithMessageField() {
+	body := `{"Message": "fake-message", "MessageId": "fake-id"}`
+
+	message := message.New(&sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(body),
+	})
+
+	u.Equal(body, message.Content)
+	u.Equal(body, message.RawBody)
+	u.Equal("SQS", message.Source)
+	u.Nil(message.Metadata.SNS)
+}
+
+func (u *UnitTest) TestParseWithSource() {
+	body := `{"Type": "Notification", "TopicArn": "arn:aws:sns:us-east-1:123456789012:topic", "Message": "fake-message"}`
+	sqsMessage := &sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(body),
+	}
+
+	auto, err := message.ParseWithSource(sqsMessage, message.SourceAuto)
+
+	u.NoError(err)
+	u.Equal("fake-message", auto.Content)
+	u.Equal(body, auto.RawBody)
+
+	raw, err := message.ParseWithSource(sqsMessage, message.SourceRaw)
+
+	u.NoError(err)
+	u.Equal(body, raw.Content)
+	u.Equal("SQS", raw.Source)
+
+	sns, err := message.ParseWithSource(sqsMessage, message.SourceSNS)
+
+	u.NoError(err)
+	u.Equal("fake-message", sns.Content)
+	u.Equal("SNS", sns.Source)
+}
+
+func (u *UnitTest) TestParseWithSourceSNS_NotSNS() {
+	message, err := message.ParseWithSource(&sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(`{"content": "fake-content"}`),
+	}, message.SourceSNS)
+
+	u.EqualError(err, "message message-id is not an SNS notification")
+	u.Equal(`{"content": "fake-content"}`, message.Content)
 }
 
 func (u *UnitTest) TestSNSWithoutMessageAttributes() {
@@ -73,6 +178,8 @@ func (u *UnitTest) TestSNSWithoutMessageAttributes() {
 		ReceiptHandle: aws.String("receipt-handle"),
 		Body: aws.String(`
 			{
+				"Type": "Notification",
+				"TopicArn": "arn:aws:sns:us-east-1:123456789012:topic",
 				"Message": "{\n  \"asda\": \"asdas\"\n}"
 			}
 		`),
@@ -92,6 +199,8 @@ func (u *UnitTest) TestUnmarshal() {
 		ReceiptHandle: aws.String("receipt-handle"),
 		Body: aws.String(`
 			{
+				"Type": "Notification",
+				"TopicArn": "arn:aws:sns:us-east-1:123456789012:topic",
 				"Message": "{\n  \"name\": \"test\"\n}",
 				"MessageAttributes": {
 					"attribute1": {
@@ -140,3 +249,152 @@ func (u *UnitTest) TestUnmarshalWithError() {
 	u.Equal("not a json", message.Content)
 	u.NotNil(err)
 }
+
+func (u *UnitTest) TestField() {
+	sqsMessage := sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(`{"detail": {"type": "created", "items": [{"id": 1, "gift": true}]}}`),
+	}
+
+	message := message.New(&sqsMessage)
+
+	value, ok := message.Field("detail.type")
+	u.True(ok)
+	u.Equal("created", value)
+
+	value, ok = message.Field("$.detail.items.0.id")
+	u.True(ok)
+	u.Equal("1", value)
+
+	value, ok = message.Field("detail.items.0.gift")
+	u.True(ok)
+	u.Equal("true", value)
+
+	_, ok = message.Field("detail.items.1.id")
+	u.False(ok)
+
+	_, ok = message.Field("detail")
+	u.False(ok)
+}
+
+func (u *UnitTest) TestUnmarshalWithContentType() {
+	body, _ := codec.Encode(codec.MessagePack, map[string]string{"name": "test"})
+
+	sqsMessage := sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(body),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"content-type": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String("application/x-msgpack"),
+			},
+		},
+	}
+
+	User := struct {
+		Name string `msgpack:"name"`
+	}{}
+
+	u.NoError(message.New(&sqsMessage).Unmarshal(&User))
+	u.Equal("test", User.Name)
+}
+
+func (u *UnitTest) TestUnmarshalWithCodec() {
+	body, _ := codec.Encode(codec.MessagePack, map[string]string{"name": "test"})
+
+	sqsMessage := sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(body),
+	}
+
+	message := message.New(&sqsMessage)
+	message.Codec = codec.MessagePack
+
+	User := struct {
+		Name string `msgpack:"name"`
+	}{}
+
+	u.NoError(message.Unmarshal(&User))
+	u.Equal("test", User.Name)
+}
+
+func (u *UnitTest) TestUnmarshalWithUnknownContentType() {
+	sqsMessage := sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(`{"name": "test"}`),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"content-type": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String("application/avro"),
+			},
+		},
+	}
+
+	err := message.New(&sqsMessage).Unmarshal(&struct{}{})
+
+	u.EqualError(err, "unknown content type application/avro")
+}
+
+func (u *UnitTest) TestParseCompressed() {
+	body, _ := compression.Encode(compression.Gzip, `{"name": "test"}`)
+
+	sqsMessage := sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(body),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"content-encoding": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String("gzip"),
+			},
+		},
+	}
+
+	message, err := message.Parse(&sqsMessage)
+
+	u.NoError(err)
+	u.Equal(`{"name": "test"}`, message.Content)
+}
+
+func (u *UnitTest) TestParseUnknownEncoding() {
+	sqsMessage := sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String("fake-content"),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"content-encoding": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String("br"),
+			},
+		},
+	}
+
+	message, err := message.Parse(&sqsMessage)
+
+	u.EqualError(err, "failed to decode content of message message-id: unknown content encoding br")
+	u.Equal("fake-content", message.Content)
+}
+
+func (u *UnitTest) TestAck() {
+	msg := message.New(&sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String("fake-content"),
+	})
+
+	calls := 0
+
+	// The hooks registered on copies of the message are shared
+	msg.WithContext(context.Background()).OnAck(func() {
+		calls++
+	})
+
+	msg.Ack()
+	msg.Ack()
+
+	u.Equal(1, calls)
+}
@@ -0,0 +1,192 @@
+package message
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// CertFetcher returns the certificate SNS signed a notification with
+type CertFetcher interface {
+	Fetch(ctx context.Context, certURL string) (*x509.Certificate, error)
+}
+
+// signingCertHost matches the hosts SNS serves its signing certificates from
+var signingCertHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// VerifySignature verifies the signature of the SNS notification the message was delivered in, with the certificate returned by fetcher.
+// It returns an error when the message was not delivered by SNS, the certificate is not served by SNS over HTTPS, or the signature is invalid.
+func (m *Message) VerifySignature(ctx context.Context, fetcher CertFetcher) error {
+	notification := m.Metadata.SNS
+
+	if notification == nil {
+		return fmt.Errorf("message %s was not delivered by SNS", m.Metadata.MessageId)
+	}
+
+	if err := notification.verify(ctx, fetcher); err != nil {
+		return fmt.Errorf("failed to verify signature of message %s: %w", m.Metadata.MessageId, err)
+	}
+
+	return nil
+}
+
+func (n *SNSMessageBody) verify(ctx context.Context, fetcher CertFetcher) error {
+	var hash crypto.Hash
+
+	switch n.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("unknown signature version %s", n.SignatureVersion)
+	}
+
+	certURL, err := url.Parse(n.SigningCertURL)
+
+	if err != nil || certURL.Scheme != "https" || !signingCertHost.MatchString(certURL.Host) {
+		return fmt.Errorf("invalid signing certificate URL %s", n.SigningCertURL)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(n.Signature)
+
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	cert, err := fetcher.Fetch(ctx, n.SigningCertURL)
+
+	if err != nil {
+		return err
+	}
+
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+
+	if !ok {
+		return errors.New("signing certificate has no RSA public key")
+	}
+
+	return rsa.VerifyPKCS1v15(publicKey, hash, digest(hash, n.stringToSign()), signature)
+}
+
+// stringToSign returns the fields of the notification in the format signed by SNS
+func (n *SNSMessageBody) stringToSign() string {
+	fields := [][2]string{
+		{"Message", n.Message},
+		{"MessageId", n.MessageId},
+	}
+
+	if n.Subject != "" {
+		fields = append(fields, [2]string{"Subject", n.Subject})
+	}
+
+	fields = append(fields,
+		[2]string{"Timestamp", n.Timestamp},
+		[2]string{"TopicArn", n.TopicArn},
+		[2]string{"Type", n.Type},
+	)
+
+	builder := strings.Builder{}
+
+	for _, field := range fields {
+		builder.WriteString(field[0] + "\n" + field[1] + "\n")
+	}
+
+	return builder.String()
+}
+
+func digest(hash crypto.Hash, content string) []byte {
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum([]byte(content))
+
+		return sum[:]
+	}
+
+	sum := sha256.Sum256([]byte(content))
+
+	return sum[:]
+}
+
+type httpCertFetcher struct {
+	client *http.Client
+	mu     sync.Mutex
+	certs  map[string]*x509.Certificate
+}
+
+// NewHTTPCertFetcher returns a CertFetcher that downloads the certificates with client and caches them by URL.
+// When client is nil, http.DefaultClient is used.
+func NewHTTPCertFetcher(client *http.Client) CertFetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &httpCertFetcher{
+		client: client,
+		certs:  make(map[string]*x509.Certificate),
+	}
+}
+
+func (f *httpCertFetcher) Fetch(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	f.mu.Lock()
+	cert, ok := f.certs[certURL]
+	f.mu.Unlock()
+
+	if ok {
+		return cert, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, certURL, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := f.client.Do(request)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing certificate: %w", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch signing certificate: status %d", response.StatusCode)
+	}
+
+	content, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(content)
+
+	if block == nil {
+		return nil, errors.New("signing certificate is not PEM encoded")
+	}
+
+	cert, err = x509.ParseCertificate(block.Bytes)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing certificate: %w", err)
+	}
+
+	f.mu.Lock()
+	f.certs[certURL] = cert
+	f.mu.Unlock()
+
+	return cert, nil
+}
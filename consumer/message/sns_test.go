@@ -0,0 +1,208 @@
+package message_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer/message"
+)
+
+const signingCertURL = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-fake.pem"
+
+type fakeCertFetcher struct {
+	cert *x509.Certificate
+}
+
+func (f *fakeCertFetcher) Fetch(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	if certURL != signingCertURL {
+		return nil, errors.New("unknown certificate")
+	}
+
+	return f.cert, nil
+}
+
+func newSigningCert() (*rsa.PrivateKey, *x509.Certificate) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	cert, _ := x509.ParseCertificate(der)
+
+	return key, cert
+}
+
+// newSignedMessage returns a message delivered in an SNS notification signed with key, after applying tamper to the notification
+func newSignedMessage(key *rsa.PrivateKey, tamper func(notification map[string]string)) *message.Message {
+	notification := map[string]string{
+		"Type":             "Notification",
+		"MessageId":        "sns-message-id",
+		"TopicArn":         "arn:aws:sns:us-east-1:123456789012:topic",
+		"Subject":          "fake-subject",
+		"Message":          `{"orderId": "123"}`,
+		"Timestamp":        "2023-10-01T12:00:00.000Z",
+		"SignatureVersion": "2",
+		"SigningCertURL":   signingCertURL,
+		"UnsubscribeURL":   "https://sns.us-east-1.amazonaws.com/?Action=Unsubscribe",
+	}
+
+	stringToSign := "Message\n" + notification["Message"] + "\n" +
+		"MessageId\n" + notification["MessageId"] + "\n" +
+		"Subject\n" + notification["Subject"] + "\n" +
+		"Timestamp\n" + notification["Timestamp"] + "\n" +
+		"TopicArn\n" + notification["TopicArn"] + "\n" +
+		"Type\n" + notification["Type"] + "\n"
+
+	digest := sha256.Sum256([]byte(stringToSign))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+
+	notification["Signature"] = base64.StdEncoding.EncodeToString(signature)
+
+	if tamper != nil {
+		tamper(notification)
+	}
+
+	body, _ := json.Marshal(notification)
+
+	return message.New(&sqs.Message{
+		MessageId:     aws.String("message-id"),
+		ReceiptHandle: aws.String("receipt-handle"),
+		Body:          aws.String(string(body)),
+	})
+}
+
+func (u *UnitTest) TestSNSMetadata() {
+	key, _ := newSigningCert()
+
+	message := newSignedMessage(key, nil)
+
+	u.Equal(`{"orderId": "123"}`, message.Content)
+	u.Equal("Notification", message.Metadata.SNS.Type)
+	u.Equal("sns-message-id", message.Metadata.SNS.MessageId)
+	u.Equal("arn:aws:sns:us-east-1:123456789012:topic", message.Metadata.SNS.TopicArn)
+	u.Equal("fake-subject", message.Metadata.SNS.Subject)
+	u.Equal("2023-10-01T12:00:00.000Z", message.Metadata.SNS.Timestamp)
+	u.Equal(signingCertURL, message.Metadata.SNS.SigningCertURL)
+	u.NotEmpty(message.Metadata.SNS.Signature)
+}
+
+func (u *UnitTest) TestVerifySignature() {
+	key, cert := newSigningCert()
+
+	err := newSignedMessage(key, nil).VerifySignature(context.Background(), &fakeCertFetcher{cert: cert})
+
+	u.NoError(err)
+}
+
+func (u *UnitTest) TestVerifySignatureWithTamperedMessage() {
+	key, cert := newSigningCert()
+
+	message := newSignedMessage(key, func(notification map[string]string) {
+		notification["Message"] = `{"orderId": "456"}`
+	})
+
+	err := message.VerifySignature(context.Background(), &fakeCertFetcher{cert: cert})
+
+	u.ErrorContains(err, "failed to verify signature of message message-id")
+}
+
+func (u *UnitTest) TestVerifySignatureWithOtherCert() {
+	key, _ := newSigningCert()
+	_, otherCert := newSigningCert()
+
+	err := newSignedMessage(key, nil).VerifySignature(context.Background(), &fakeCertFetcher{cert: otherCert})
+
+	u.ErrorContains(err, "failed to verify signature of message message-id")
+}
+
+func (u *UnitTest) TestVerifySignatureWithInvalidCertURL() {
+	key, cert := newSigningCert()
+
+	for _, certURL := range []string{
+		"http://sns.us-east-1.amazonaws.com/SimpleNotificationService-fake.pem",
+		"https://sns.us-east-1.amazonaws.com.attacker.com/SimpleNotificationService-fake.pem",
+		"https://attacker.com/SimpleNotificationService-fake.pem",
+	} {
+		message := newSignedMessage(key, func(notification map[string]string) {
+			notification["SigningCertURL"] = certURL
+		})
+
+		err := message.VerifySignature(context.Background(), &fakeCertFetcher{cert: cert})
+
+		u.EqualError(err, "failed to verify signature of message message-id: invalid signing certificate URL "+certURL)
+	}
+}
+
+func (u *UnitTest) TestVerifySignatureWithUnknownVersion() {
+	key, cert := newSigningCert()
+
+	message := newSignedMessage(key, func(notification map[string]string) {
+		notification["SignatureVersion"] = "3"
+	})
+
+	err := message.VerifySignature(context.Background(), &fakeCertFetcher{cert: cert})
+
+	u.EqualError(err, "failed to verify signature of message message-id: unknown signature version 3")
+}
+
+func (u *UnitTest) TestVerifySignatureWithoutSNS() {
+	_, cert := newSigningCert()
+
+	err := newEventMessage(`{"content": "fake-content"}`).VerifySignature(context.Background(), &fakeCertFetcher{cert: cert})
+
+	u.EqualError(err, "message message-id was not delivered by SNS")
+}
+
+func (u *UnitTest) TestHTTPCertFetcher() {
+	_, cert := newSigningCert()
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}))
+	defer server.Close()
+
+	fetcher := message.NewHTTPCertFetcher(server.Client())
+
+	for i := 0; i < 2; i++ {
+		fetched, err := fetcher.Fetch(context.Background(), server.URL+"/cert.pem")
+
+		u.NoError(err)
+		u.True(cert.Equal(fetched))
+	}
+
+	u.Equal(1, requests)
+}
+
+func (u *UnitTest) TestHTTPCertFetcherWithError() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := message.NewHTTPCertFetcher(server.Client()).Fetch(context.Background(), server.URL+"/cert.pem")
+
+	u.EqualError(err, "failed to fetch signing certificate: status 404")
+}
@@ -0,0 +1,88 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+)
+
+// Pauser is implemented by clients that can pause consuming individual queues
+type Pauser interface {
+	// Pause stops receiving new messages from the queue. Messages already received are still processed.
+	Pause(queue string)
+	// Resume starts receiving messages from a paused queue again
+	Resume(queue string)
+}
+
+// pauseSet holds the paused queues. Each paused queue has a channel that is closed when it is resumed.
+type pauseSet struct {
+	mu     sync.Mutex
+	queues map[string]chan struct{}
+}
+
+func (p *pauseSet) pause(queue string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.queues == nil {
+		p.queues = make(map[string]chan struct{})
+	}
+
+	if _, ok := p.queues[queue]; !ok {
+		p.queues[queue] = make(chan struct{})
+	}
+}
+
+func (p *pauseSet) resume(queue string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if resumed, ok := p.queues[queue]; ok {
+		close(resumed)
+		delete(p.queues, queue)
+	}
+}
+
+func (p *pauseSet) isPaused(queue string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.queues[queue]
+
+	return ok
+}
+
+// wait blocks while the queue is paused or until the context is cancelled
+func (p *pauseSet) wait(ctx context.Context, queue string) {
+	p.mu.Lock()
+	resumed, ok := p.queues[queue]
+	p.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-resumed:
+	}
+}
+
+// Pause stops receiving new messages from the queue while the messages already received are processed.
+// The queue is identified by its name, so a single queue of a PrefixBased client can be paused.
+func (s *SQSClient) Pause(queue string) {
+	s.paused.pause(queue)
+
+	s.Logger.Log("paused queue %s", queue)
+}
+
+// Resume starts receiving messages from a paused queue again
+func (s *SQSClient) Resume(queue string) {
+	s.paused.resume(queue)
+
+	s.Logger.Log("resumed queue %s", queue)
+}
+
+// IsPaused reports whether the queue is paused
+func (s *SQSClient) IsPaused(queue string) bool {
+	return s.paused.isPaused(queue)
+}
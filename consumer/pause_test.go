@@ -0,0 +1,82 @@
+package consumer_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/stretchr/testify/mock"
+)
+
+func (uts *UnitTest) TestPauseAndResume() {
+	uts.mockSQSService.On("ListQueues", mock.Anything).Return(&sqs.ListQueuesOutput{
+		QueueUrls: []*string{
+			aws.String("https://fake-queue-url/fake-queue-name-1"),
+			aws.String("https://fake-queue-url/fake-queue-name-2"),
+		},
+	}, nil)
+
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(&sqs.ReceiveMessageOutput{}, nil)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName:   "fake-queue-name",
+		PrefixBased: true,
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+	})
+
+	client.Pause("fake-queue-name-1")
+
+	uts.True(client.IsPaused("fake-queue-name-1"))
+	uts.False(client.IsPaused("fake-queue-name-2"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go client.Run(ctx)
+
+	time.Sleep(600 * time.Millisecond)
+
+	uts.mockSQSService.AssertNotCalled(uts.T(), "ReceiveMessage", receiveInput("https://fake-queue-url/fake-queue-name-1"))
+	uts.mockSQSService.AssertCalled(uts.T(), "ReceiveMessage", receiveInput("https://fake-queue-url/fake-queue-name-2"))
+
+	client.Resume("fake-queue-name-1")
+
+	time.Sleep(600 * time.Millisecond)
+
+	uts.False(client.IsPaused("fake-queue-name-1"))
+	uts.mockSQSService.AssertCalled(uts.T(), "ReceiveMessage", receiveInput("https://fake-queue-url/fake-queue-name-1"))
+}
+
+func (uts *UnitTest) TestPause_StopsWhenCancelled() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+	})
+
+	client.Pause("fake-queue-name")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	uts.NoError(client.Run(ctx))
+	uts.mockSQSService.AssertNotCalled(uts.T(), "ReceiveMessage", mock.Anything)
+}
+
+func receiveInput(queueUrl string) *sqs.ReceiveMessageInput {
+	return &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(queueUrl),
+		MaxNumberOfMessages:   aws.Int64(10),
+		VisibilityTimeout:     aws.Int64(30),
+		WaitTimeSeconds:       aws.Int64(20),
+		AttributeNames:        []*string{aws.String("All")},
+		MessageAttributeNames: []*string{aws.String("All")},
+	}
+}
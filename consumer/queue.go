@@ -0,0 +1,69 @@
+package consumer
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+// queueHost matches the hosts of the queue URLs of SQS, in the current and legacy formats, capturing the region
+var queueHost = regexp.MustCompile(`^(?:sqs\.([a-z0-9-]+)|([a-z0-9-]+)\.queue)\.amazonaws\.com(?:\.cn)?$`)
+
+// queueLocation is a queue configured by name, URL or ARN
+type queueLocation struct {
+	Name string
+	// Url is set when the queue is configured by URL, so it does not need to be resolved
+	Url string
+	// Region and AccountId are set when the queue is configured by URL or ARN. Region is empty for the URLs of custom endpoints.
+	Region    string
+	AccountId string
+}
+
+// parseQueue parses the QueueName option, which is either the name of a queue of the account, its URL, e.g.
+// https://sqs.us-east-2.amazonaws.com/123456789012/orders, or its ARN, e.g. arn:aws:sqs:us-east-2:123456789012:orders
+func parseQueue(queue string) (queueLocation, error) {
+	if arn.IsARN(queue) {
+		parsed, err := arn.Parse(queue)
+
+		if err != nil || parsed.Service != "sqs" || parsed.Resource == "" {
+			return queueLocation{}, fmt.Errorf("invalid queue ARN %s", queue)
+		}
+
+		return queueLocation{
+			Name:      parsed.Resource,
+			Region:    parsed.Region,
+			AccountId: parsed.AccountID,
+		}, nil
+	}
+
+	if !strings.HasPrefix(queue, "https://") && !strings.HasPrefix(queue, "http://") {
+		return queueLocation{Name: queue}, nil
+	}
+
+	parsed, err := url.Parse(queue)
+
+	if err != nil {
+		return queueLocation{}, fmt.Errorf("invalid queue URL %s: %w", queue, err)
+	}
+
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+
+	if len(segments) != 2 || segments[0] == "" || segments[1] == "" {
+		return queueLocation{}, fmt.Errorf("invalid queue URL %s", queue)
+	}
+
+	location := queueLocation{
+		Name:      segments[1],
+		Url:       queue,
+		AccountId: segments[0],
+	}
+
+	if match := queueHost.FindStringSubmatch(parsed.Hostname()); match != nil {
+		location.Region = match[1] + match[2]
+	}
+
+	return location, nil
+}
@@ -0,0 +1,99 @@
+package consumer_test
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/stretchr/testify/mock"
+)
+
+func (ut *UnitTest) TestQueue_URL() {
+	client := consumer.New(ut.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "https://sqs.eu-west-1.amazonaws.com/123456789012/fake-queue-name",
+		Handle:    func(message *message.Message) bool { return true },
+	})
+
+	ut.Equal("https://sqs.eu-west-1.amazonaws.com/123456789012/fake-queue-name", *client.GetQueueUrl())
+	ut.mockSQSService.AssertNotCalled(ut.T(), "GetQueueUrl", mock.Anything)
+	ut.Equal("fake-queue-name", client.Health()[0].Queue)
+}
+
+func (ut *UnitTest) TestQueue_ARN() {
+	ut.mockSQSService.On("GetQueueUrl", &sqs.GetQueueUrlInput{
+		QueueName:              aws.String("fake-queue-name"),
+		QueueOwnerAWSAccountId: aws.String("123456789012"),
+	}).Return(&sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/fake-queue-name")}, nil)
+
+	client := consumer.New(ut.mockSQSService, consumer.SQSClientOptions{
+		QueueName:              "arn:aws:sqs:eu-west-1:123456789012:fake-queue-name",
+		QueueOwnerAWSAccountId: "210987654321",
+		Handle:                 func(message *message.Message) bool { return true },
+	})
+
+	ut.Equal("https://sqs.eu-west-1.amazonaws.com/123456789012/fake-queue-name", *client.GetQueueUrl())
+}
+
+func (ut *UnitTest) TestQueue_OwnerAccount() {
+	ut.mockSQSService.On("GetQueueUrl", &sqs.GetQueueUrlInput{
+		QueueName:              aws.String("fake-queue-name"),
+		QueueOwnerAWSAccountId: aws.String("123456789012"),
+	}).Return(&sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.us-east-1.amazonaws.com/123456789012/fake-queue-name")}, nil)
+
+	client := consumer.New(ut.mockSQSService, consumer.SQSClientOptions{
+		QueueName:              "fake-queue-name",
+		QueueOwnerAWSAccountId: "123456789012",
+		Handle:                 func(message *message.Message) bool { return true },
+	})
+
+	ut.Equal("https://sqs.us-east-1.amazonaws.com/123456789012/fake-queue-name", *client.GetQueueUrl())
+}
+
+func (ut *UnitTest) TestQueue_Region() {
+	ut.isolateAWSEnvironment()
+
+	for queueName, host := range map[string]string{
+		"arn:aws:sqs:eu-west-1:123456789012:fake-queue-name":                    "sqs.eu-west-1.amazonaws.com",
+		"https://sqs.ap-southeast-2.amazonaws.com/123456789012/fake-queue-name": "sqs.ap-southeast-2.amazonaws.com",
+		"https://us-west-2.queue.amazonaws.com/123456789012/fake-queue-name":    "sqs.us-west-2.amazonaws.com",
+	} {
+		transport := &fakeAWSTransport{}
+
+		client := consumer.New(nil, consumer.SQSClientOptions{
+			QueueName:   queueName,
+			Region:      "us-east-1",
+			Handle:      func(message *message.Message) bool { return true },
+			Credentials: credentials.NewStaticCredentials("STATIC_ACCESS_KEY", "fake-secret", ""),
+			HTTPClient:  &http.Client{Transport: transport},
+		})
+
+		_, err := client.Client.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String("fake-queue-name")})
+
+		ut.Require().NoError(err)
+		ut.Equal(host, transport.requests[0].Host, queueName)
+	}
+}
+
+func (ut *UnitTest) TestQueue_Invalid() {
+	ut.PanicsWithError("invalid queue ARN arn:aws:sns:us-east-1:123456789012:fake-topic", func() {
+		consumer.New(ut.mockSQSService, consumer.SQSClientOptions{
+			QueueName: "arn:aws:sns:us-east-1:123456789012:fake-topic",
+		})
+	})
+
+	ut.PanicsWithError("invalid queue URL https://sqs.us-east-1.amazonaws.com/fake-queue-name", func() {
+		consumer.New(ut.mockSQSService, consumer.SQSClientOptions{
+			QueueName: "https://sqs.us-east-1.amazonaws.com/fake-queue-name",
+		})
+	})
+
+	ut.PanicsWithValue("PrefixBased requires a queue name, not a URL or ARN", func() {
+		consumer.New(ut.mockSQSService, consumer.SQSClientOptions{
+			QueueName:   "arn:aws:sqs:us-east-1:123456789012:fake-queue",
+			PrefixBased: true,
+		})
+	})
+}
@@ -0,0 +1,132 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit defines how many messages can be processed per second
+type RateLimit struct {
+	// MessagesPerSecond must be positive
+	MessagesPerSecond float64
+	// Burst is the maximum number of messages processed at once. Defaults to 1.
+	Burst int
+}
+
+// NewRateLimiter returns a limiter that can be shared by several clients through the SharedRateLimiter option
+func NewRateLimiter(limit RateLimit) *rate.Limiter {
+	if limit.Burst == 0 {
+		limit.Burst = 1
+	}
+
+	return rate.NewLimiter(rate.Limit(limit.MessagesPerSecond), limit.Burst)
+}
+
+// rateLimiter makes the messages wait for a token of every limiter before being processed.
+// It also keeps track of the received messages still waiting for a token, so no more messages are received while there are any.
+type rateLimiter struct {
+	limiters []*rate.Limiter
+	mu       sync.Mutex
+	// waiting is the number of messages of each queue that are waiting for a token
+	waiting map[string]int
+	// changed is closed and replaced whenever a message gets its token
+	changed chan struct{}
+}
+
+func newRateLimiter(limiters ...*rate.Limiter) *rateLimiter {
+	return &rateLimiter{
+		limiters: limiters,
+		waiting:  make(map[string]int),
+		changed:  make(chan struct{}),
+	}
+}
+
+// batchSize returns the maximum number of messages that can be processed within the visibility timeout
+func (r *rateLimiter) batchSize(visibilityTimeout int64) int64 {
+	size := int64(-1)
+
+	for _, limiter := range r.limiters {
+		limit := int64(float64(limiter.Limit()) * float64(visibilityTimeout))
+
+		if size == -1 || limit < size {
+			size = limit
+		}
+	}
+
+	if size < 1 {
+		return 1
+	}
+
+	return size
+}
+
+// received records messages received from the queue that will wait for a token
+func (r *rateLimiter) received(queue string, count int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.waiting[queue] += count
+}
+
+// waitReceive blocks until every message received from the queue got its token. It returns false if the context is cancelled.
+func (r *rateLimiter) waitReceive(ctx context.Context, queue string) bool {
+	for {
+		r.mu.Lock()
+		waiting := r.waiting[queue]
+		changed := r.changed
+		r.mu.Unlock()
+
+		if waiting == 0 {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// wait blocks until the message of the queue gets a token from every limiter
+func (r *rateLimiter) wait(ctx context.Context, queue string) error {
+	defer r.release(queue)
+
+	for _, limiter := range r.limiters {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *rateLimiter) release(queue string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.waiting[queue] > 0 {
+		r.waiting[queue]--
+	}
+
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (s *SQSClient) setRateLimiter() {
+	limiters := []*rate.Limiter{}
+
+	if s.ClientOptions.RateLimit != nil {
+		limiters = append(limiters, NewRateLimiter(*s.ClientOptions.RateLimit))
+	}
+
+	if s.ClientOptions.SharedRateLimiter != nil {
+		limiters = append(limiters, s.ClientOptions.SharedRateLimiter)
+	}
+
+	if len(limiters) > 0 {
+		s.rateLimiter = newRateLimiter(limiters...)
+	}
+}
@@ -0,0 +1,132 @@
+package consumer_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/stretchr/testify/mock"
+)
+
+func (uts *UnitTest) TestRateLimit_ProcessMessage() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+		RateLimit: &consumer.RateLimit{MessagesPerSecond: 10},
+	})
+
+	message := &sqs.Message{
+		Body:          aws.String(`{"content": "fake-content"}`),
+		ReceiptHandle: aws.String("fake-receipt-handle"),
+		MessageId:     aws.String("fake-message-id"),
+	}
+
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		client.ProcessMessage(message, "https://fake-queue-url")
+	}
+
+	uts.GreaterOrEqual(time.Since(start), 200*time.Millisecond)
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessage", 3)
+}
+
+func (uts *UnitTest) TestRateLimit_SharedRateLimiter() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	limiter := consumer.NewRateLimiter(consumer.RateLimit{MessagesPerSecond: 10})
+
+	clients := []*consumer.SQSClient{}
+
+	for _, queueName := range []string{"fake-queue-name-1", "fake-queue-name-2"} {
+		clients = append(clients, consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+			QueueName: queueName,
+			Handle: func(message *message.Message) bool {
+				return true
+			},
+			SharedRateLimiter: limiter,
+		}))
+	}
+
+	message := &sqs.Message{
+		Body:          aws.String(`{"content": "fake-content"}`),
+		ReceiptHandle: aws.String("fake-receipt-handle"),
+		MessageId:     aws.String("fake-message-id"),
+	}
+
+	start := time.Now()
+
+	clients[0].ProcessMessage(message, "https://fake-queue-url/fake-queue-name-1")
+	clients[1].ProcessMessage(message, "https://fake-queue-url/fake-queue-name-2")
+	clients[0].ProcessMessage(message, "https://fake-queue-url/fake-queue-name-1")
+
+	uts.GreaterOrEqual(time.Since(start), 200*time.Millisecond)
+}
+
+func (uts *UnitTest) TestRateLimit_ThrottlesReceive() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(&sqs.ReceiveMessageOutput{
+		Messages: []*sqs.Message{
+			{
+				Body:          aws.String(`{"content": "fake-content"}`),
+				ReceiptHandle: aws.String("fake-receipt-handle-1"),
+				MessageId:     aws.String("fake-message-id-1"),
+			},
+			{
+				Body:          aws.String(`{"content": "fake-content"}`),
+				ReceiptHandle: aws.String("fake-receipt-handle-2"),
+				MessageId:     aws.String("fake-message-id-2"),
+			},
+		},
+	}, nil)
+
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+		RateLimit: &consumer.RateLimit{MessagesPerSecond: 0.1},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(1200*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	// Only 3 messages can be processed within the visibility timeout (30 seconds)
+	uts.mockSQSService.AssertCalled(uts.T(), "ReceiveMessage", mock.MatchedBy(func(input *sqs.ReceiveMessageInput) bool {
+		return *input.MaxNumberOfMessages == 3
+	}))
+	// The second message is still waiting for a token, so no more messages are received
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "ReceiveMessage", 1)
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessage", 1)
+	// It is released when the client stops
+	uts.mockSQSService.AssertCalled(uts.T(), "ChangeMessageVisibility", mock.MatchedBy(func(input *sqs.ChangeMessageVisibilityInput) bool {
+		return *input.VisibilityTimeout == 0
+	}))
+}
+
+func (uts *UnitTest) TestRateLimit_InvalidMessagesPerSecond() {
+	for _, messagesPerSecond := range []float64{0, -1} {
+		uts.PanicsWithValue("RateLimit requires a positive MessagesPerSecond", func() {
+			consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+				QueueName: "fake-queue-name",
+				RateLimit: &consumer.RateLimit{MessagesPerSecond: messagesPerSecond},
+			})
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package router
+
+import (
+	"github.com/inaciogu/go-sqs/consumer/message"
+)
+
+// HandlerFunc has the same signature as the Handle option of the consumer
+type HandlerFunc func(message *message.Message) bool
+
+// KeyFunc extracts the value used to route the message. It returns false when the message has no such value.
+type KeyFunc func(message *message.Message) (string, bool)
+
+// Router dispatches every message to the handler registered for its key, so a single queue can carry several event types.
+// Its Handle method can be used as the Handle option of the consumer. Routes must be registered before the consumer starts.
+type Router struct {
+	key      KeyFunc
+	routes   map[string]HandlerFunc
+	fallback HandlerFunc
+}
+
+// New returns a router that dispatches messages on the value returned by key
+func New(key KeyFunc) *Router {
+	return &Router{
+		key:    key,
+		routes: make(map[string]HandlerFunc),
+	}
+}
+
+// ByAttribute returns a router that dispatches messages on the value of a message attribute, e.g. "eventType".
+// Attributes of messages delivered by SNS are supported as well.
+func ByAttribute(name string) *Router {
+	return New(func(message *message.Message) (string, bool) {
+		value, ok := message.Metadata.MessageAttributes[name]
+
+		return value, ok
+	})
+}
+
+// ByTopicArn returns a router that dispatches messages delivered by SNS on the ARN of their topic
+func ByTopicArn() *Router {
+	return New(func(message *message.Message) (string, bool) {
+		return message.Metadata.TopicArn, message.Metadata.TopicArn != ""
+	})
+}
+
+// ByField returns a router that dispatches messages on a field of their JSON content, e.g. "detail.type".
+// See message.Field for the supported paths.
+func ByField(path string) *Router {
+	return New(func(message *message.Message) (string, bool) {
+		return message.Field(path)
+	})
+}
+
+// Route registers the handler of the messages with the given key
+func (r *Router) Route(key string, handle HandlerFunc) *Router {
+	r.routes[key] = handle
+
+	return r
+}
+
+// Fallback registers the handler of the messages without a key or with a key that has no route.
+// Without a fallback, those messages are not handled, so they are retried and eventually moved to the dead-letter queue.
+func (r *Router) Fallback(handle HandlerFunc) *Router {
+	r.fallback = handle
+
+	return r
+}
+
+// Handle dispatches the message to the handler of its key
+func (r *Router) Handle(message *message.Message) bool {
+	key, ok := r.key(message)
+
+	if ok {
+		if handle, ok := r.routes[key]; ok {
+			return handle(message)
+		}
+	}
+
+	if r.fallback != nil {
+		return r.fallback(message)
+	}
+
+	return false
+}
+
+// Typed returns a handler that unmarshals the JSON content of the message into T before calling handle.
+// Messages that can not be unmarshalled are not handled.
+func Typed[T any](handle func(message *message.Message, value T) bool) HandlerFunc {
+	return func(message *message.Message) bool {
+		var value T
+
+		if err := message.Unmarshal(&value); err != nil {
+			return false
+		}
+
+		return handle(message, value)
+	}
+}
@@ -0,0 +1,136 @@
+package router_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/inaciogu/go-sqs/consumer/router"
+	"github.com/stretchr/testify/suite"
+)
+
+type UnitTest struct {
+	suite.Suite
+}
+
+func TestUnitSuites(t *testing.T) {
+	suite.Run(t, &UnitTest{})
+}
+
+func newMessage(body string, attributes map[string]string) *message.Message {
+	sqsMessage := &sqs.Message{
+		MessageId:         aws.String("message-id"),
+		ReceiptHandle:     aws.String("receipt-handle"),
+		Body:              aws.String(body),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{},
+	}
+
+	for key, value := range attributes {
+		sqsMessage.MessageAttributes[key] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+
+	return message.New(sqsMessage)
+}
+
+// record returns a handler that appends name to routed when it is called
+func record(routed *[]string, name string) router.HandlerFunc {
+	return func(message *message.Message) bool {
+		*routed = append(*routed, name)
+
+		return true
+	}
+}
+
+func (u *UnitTest) TestByAttribute() {
+	routed := []string{}
+
+	r := router.ByAttribute("eventType").
+		Route("order.created", record(&routed, "created")).
+		Route("order.cancelled", record(&routed, "cancelled"))
+
+	u.True(r.Handle(newMessage(`{}`, map[string]string{"eventType": "order.cancelled"})))
+	u.True(r.Handle(newMessage(`{}`, map[string]string{"eventType": "order.created"})))
+	u.Equal([]string{"cancelled", "created"}, routed)
+}
+
+func (u *UnitTest) TestByAttribute_SNS() {
+	routed := []string{}
+
+	r := router.ByAttribute("eventType").Route("order.created", record(&routed, "created"))
+
+	u.True(r.Handle(newMessage(`{
+		"Type": "Notification",
+		"TopicArn": "arn:aws:sns:us-east-1:123456789012:orders",
+		"Message": "{}",
+		"MessageAttributes": {"eventType": {"Type": "String", "Value": "order.created"}}
+	}`, nil)))
+	u.Equal([]string{"created"}, routed)
+}
+
+func (u *UnitTest) TestByTopicArn() {
+	routed := []string{}
+
+	r := router.ByTopicArn().
+		Route("arn:aws:sns:us-east-1:123456789012:orders", record(&routed, "orders")).
+		Fallback(record(&routed, "fallback"))
+
+	u.True(r.Handle(newMessage(`{"Type": "Notification", "Message": "{}", "TopicArn": "arn:aws:sns:us-east-1:123456789012:orders"}`, nil)))
+	u.True(r.Handle(newMessage(`{"content": "fake-content"}`, nil)))
+	u.Equal([]string{"orders", "fallback"}, routed)
+}
+
+func (u *UnitTest) TestByField() {
+	routed := []string{}
+
+	r := router.ByField("$.detail.items.0.type").
+		Route("book", record(&routed, "book")).
+		Route("42", record(&routed, "number"))
+
+	u.True(r.Handle(newMessage(`{"detail": {"items": [{"type": "book"}]}}`, nil)))
+	u.True(r.Handle(newMessage(`{"detail": {"items": [{"type": 42}]}}`, nil)))
+	u.Equal([]string{"book", "number"}, routed)
+}
+
+func (u *UnitTest) TestFallback() {
+	routed := []string{}
+
+	r := router.ByField("type").
+		Route("known", record(&routed, "known")).
+		Fallback(record(&routed, "fallback"))
+
+	u.True(r.Handle(newMessage(`{"type": "unknown"}`, nil)))
+	u.True(r.Handle(newMessage(`{"other": "field"}`, nil)))
+	u.True(r.Handle(newMessage(`not json`, nil)))
+	u.Equal([]string{"fallback", "fallback", "fallback"}, routed)
+}
+
+func (u *UnitTest) TestWithoutFallback() {
+	r := router.ByField("type").Route("known", func(message *message.Message) bool {
+		return true
+	})
+
+	u.False(r.Handle(newMessage(`{"type": "unknown"}`, nil)))
+}
+
+func (u *UnitTest) TestTyped() {
+	type order struct {
+		Type string `json:"type"`
+		ID   int    `json:"id"`
+	}
+
+	ids := []int{}
+
+	r := router.ByField("type").Route("order", router.Typed(func(message *message.Message, value order) bool {
+		ids = append(ids, value.ID)
+
+		return true
+	}))
+
+	u.True(r.Handle(newMessage(`{"type": "order", "id": 1}`, nil)))
+	u.False(r.Handle(newMessage(`{"type": "order", "id": "not a number"}`, nil)))
+	u.Equal([]int{1}, ids)
+}
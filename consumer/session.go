@@ -0,0 +1,74 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+type AssumeRoleOptions struct {
+	// RoleArn is the ARN of the role to assume
+	RoleArn string
+	// ExternalId is required by roles that trust a third-party account
+	ExternalId string
+	// SessionName identifies the session in CloudTrail. Defaults to a name generated by the SDK.
+	SessionName string
+	// Duration is the lifetime of the credentials, which are refreshed before they expire. Defaults to 15 minutes.
+	Duration time.Duration
+}
+
+// newSQSService builds the SQS client used when none is passed to New. Credentials are resolved by the default chain of the SDK
+// (environment, shared config and credentials files, SSO, web identity, ECS and EC2 roles) unless Credentials is set,
+// and the shared config is loaded, so the region and role of the profile are used.
+func newSQSService(options SQSClientOptions) (*sqs.SQS, error) {
+	config := aws.Config{
+		Credentials: options.Credentials,
+		HTTPClient:  options.HTTPClient,
+	}
+
+	if options.Region != "" {
+		config.Region = aws.String(options.Region)
+	}
+
+	// An empty endpoint would override the one resolved for the region
+	if options.Endpoint != "" {
+		config.Endpoint = aws.String(options.Endpoint)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            config,
+		Profile:           options.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.Region = aws.String(DefaultRegion)
+	}
+
+	if options.AssumeRole == nil {
+		return sqs.New(sess), nil
+	}
+
+	credentials := stscreds.NewCredentials(sess, options.AssumeRole.RoleArn, func(provider *stscreds.AssumeRoleProvider) {
+		if options.AssumeRole.ExternalId != "" {
+			provider.ExternalID = aws.String(options.AssumeRole.ExternalId)
+		}
+
+		if options.AssumeRole.SessionName != "" {
+			provider.RoleSessionName = options.AssumeRole.SessionName
+		}
+
+		if options.AssumeRole.Duration != 0 {
+			provider.Duration = options.AssumeRole.Duration
+		}
+	})
+
+	return sqs.New(sess, &aws.Config{Credentials: credentials}), nil
+}
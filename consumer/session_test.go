@@ -0,0 +1,160 @@
+package consumer_test
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+)
+
+type recordedRequest struct {
+	Host          string
+	Form          url.Values
+	Authorization string
+}
+
+// fakeAWSTransport answers the query protocol requests of SQS and STS, recording them
+type fakeAWSTransport struct {
+	mu       sync.Mutex
+	requests []recordedRequest
+}
+
+func (f *fakeAWSTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(r.Body)
+	form, _ := url.ParseQuery(string(body))
+
+	f.mu.Lock()
+	f.requests = append(f.requests, recordedRequest{Host: r.URL.Host, Form: form, Authorization: r.Header.Get("Authorization")})
+	f.mu.Unlock()
+
+	response := ""
+
+	switch form.Get("Action") {
+	case "GetQueueUrl":
+		response = `<GetQueueUrlResponse><GetQueueUrlResult><QueueUrl>https://fake-queue-url/fake-queue-name</QueueUrl></GetQueueUrlResult></GetQueueUrlResponse>`
+	case "AssumeRole":
+		response = `<AssumeRoleResponse><AssumeRoleResult>
+			<Credentials>
+				<AccessKeyId>ASSUMED_ACCESS_KEY</AccessKeyId>
+				<SecretAccessKey>fake-secret</SecretAccessKey>
+				<SessionToken>fake-token</SessionToken>
+				<Expiration>2100-01-01T00:00:00Z</Expiration>
+			</Credentials>
+		</AssumeRoleResult></AssumeRoleResponse>`
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/xml"}},
+		Body:       io.NopCloser(strings.NewReader(response)),
+		Request:    r,
+	}, nil
+}
+
+// isolateAWSEnvironment keeps the credentials and config of the machine out of the test
+func (uts *UnitTest) isolateAWSEnvironment() string {
+	dir := uts.T().TempDir()
+
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_CA_BUNDLE"} {
+		uts.T().Setenv(name, "")
+	}
+
+	uts.T().Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	uts.T().Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	uts.T().Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	return dir
+}
+
+// getQueueUrl builds a client without SQSService and calls GetQueueUrl through it
+func (uts *UnitTest) getQueueUrl(options consumer.SQSClientOptions) []recordedRequest {
+	transport := &fakeAWSTransport{}
+
+	options.QueueName = "fake-queue-name"
+	options.HTTPClient = &http.Client{Transport: transport}
+
+	client := consumer.New(nil, options)
+
+	_, err := client.Client.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String("fake-queue-name")})
+
+	uts.Require().NoError(err)
+
+	return transport.requests
+}
+
+func (uts *UnitTest) TestSession_DefaultEndpoint() {
+	uts.isolateAWSEnvironment()
+
+	requests := uts.getQueueUrl(consumer.SQSClientOptions{
+		Credentials: credentials.NewStaticCredentials("STATIC_ACCESS_KEY", "fake-secret", ""),
+	})
+
+	uts.Len(requests, 1)
+	uts.Equal("sqs.us-east-1.amazonaws.com", requests[0].Host)
+	uts.Contains(requests[0].Authorization, "Credential=STATIC_ACCESS_KEY/")
+}
+
+func (uts *UnitTest) TestSession_Endpoint() {
+	uts.isolateAWSEnvironment()
+
+	requests := uts.getQueueUrl(consumer.SQSClientOptions{
+		Region:      "sa-east-1",
+		Endpoint:    "http://localhost:4566",
+		Credentials: credentials.NewStaticCredentials("STATIC_ACCESS_KEY", "fake-secret", ""),
+	})
+
+	uts.Equal("localhost:4566", requests[0].Host)
+	uts.Contains(requests[0].Authorization, "/sa-east-1/sqs/")
+}
+
+func (uts *UnitTest) TestSession_EnvironmentCredentials() {
+	uts.isolateAWSEnvironment()
+	uts.T().Setenv("AWS_ACCESS_KEY_ID", "ENV_ACCESS_KEY")
+	uts.T().Setenv("AWS_SECRET_ACCESS_KEY", "fake-secret")
+
+	requests := uts.getQueueUrl(consumer.SQSClientOptions{})
+
+	uts.Contains(requests[0].Authorization, "Credential=ENV_ACCESS_KEY/")
+}
+
+func (uts *UnitTest) TestSession_Profile() {
+	dir := uts.isolateAWSEnvironment()
+
+	uts.Require().NoError(os.WriteFile(filepath.Join(dir, "config"), []byte("[profile fake-profile]\nregion = eu-west-1\n"), 0600))
+	uts.Require().NoError(os.WriteFile(filepath.Join(dir, "credentials"), []byte("[fake-profile]\naws_access_key_id = PROFILE_ACCESS_KEY\naws_secret_access_key = fake-secret\n"), 0600))
+
+	requests := uts.getQueueUrl(consumer.SQSClientOptions{Profile: "fake-profile"})
+
+	uts.Equal("sqs.eu-west-1.amazonaws.com", requests[0].Host)
+	uts.Contains(requests[0].Authorization, "Credential=PROFILE_ACCESS_KEY/")
+}
+
+func (uts *UnitTest) TestSession_AssumeRole() {
+	uts.isolateAWSEnvironment()
+
+	requests := uts.getQueueUrl(consumer.SQSClientOptions{
+		Credentials: credentials.NewStaticCredentials("BASE_ACCESS_KEY", "fake-secret", ""),
+		AssumeRole: &consumer.AssumeRoleOptions{
+			RoleArn:     "arn:aws:iam::123456789012:role/fake-role",
+			ExternalId:  "fake-external-id",
+			SessionName: "fake-session",
+		},
+	})
+
+	uts.Len(requests, 2)
+	uts.Equal("AssumeRole", requests[0].Form.Get("Action"))
+	uts.Equal("arn:aws:iam::123456789012:role/fake-role", requests[0].Form.Get("RoleArn"))
+	uts.Equal("fake-external-id", requests[0].Form.Get("ExternalId"))
+	uts.Equal("fake-session", requests[0].Form.Get("RoleSessionName"))
+	uts.Contains(requests[0].Authorization, "Credential=BASE_ACCESS_KEY/")
+	uts.Equal("GetQueueUrl", requests[1].Form.Get("Action"))
+	uts.Contains(requests[1].Authorization, "Credential=ASSUMED_ACCESS_KEY/")
+}
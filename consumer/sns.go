@@ -0,0 +1,40 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/inaciogu/go-sqs/consumer/message"
+)
+
+type SNSVerificationOptions struct {
+	// CertFetcher returns the signing certificates of SNS. Defaults to downloading them with http.DefaultClient.
+	CertFetcher message.CertFetcher
+	// Required rejects the messages that were not delivered by SNS, including those sent with raw message delivery, which are not signed
+	Required bool
+}
+
+func setDefaultSNSVerificationOptions(options *SNSVerificationOptions) {
+	if options.CertFetcher == nil {
+		options.CertFetcher = message.NewHTTPCertFetcher(nil)
+	}
+}
+
+// verifySignature verifies the signature of the message when it was delivered by SNS
+func (s *SQSClient) verifySignature(ctx context.Context, message *message.Message) error {
+	options := s.ClientOptions.SNSVerification
+
+	if options == nil {
+		return nil
+	}
+
+	if message.Metadata.SNS == nil {
+		if options.Required {
+			return fmt.Errorf("message %s was not delivered by SNS", message.Metadata.MessageId)
+		}
+
+		return nil
+	}
+
+	return message.VerifySignature(ctx, options.CertFetcher)
+}
@@ -0,0 +1,155 @@
+package consumer_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/stretchr/testify/mock"
+)
+
+type fakeCertFetcher struct {
+	cert *x509.Certificate
+}
+
+func (f *fakeCertFetcher) Fetch(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	return f.cert, nil
+}
+
+func (uts *UnitTest) newSigningCert() (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	uts.Require().NoError(err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	uts.Require().NoError(err)
+
+	cert, err := x509.ParseCertificate(der)
+
+	uts.Require().NoError(err)
+
+	return key, cert
+}
+
+// newSignedMessage returns a message delivered in an SNS notification of content signed with key
+func (uts *UnitTest) newSignedMessage(key *rsa.PrivateKey, content string) *sqs.Message {
+	notification := map[string]string{
+		"Type":             "Notification",
+		"MessageId":        "fake-sns-message-id",
+		"TopicArn":         "arn:aws:sns:us-east-1:123456789012:fake-topic",
+		"Message":          content,
+		"Timestamp":        "2023-10-01T12:00:00.000Z",
+		"SignatureVersion": "2",
+		"SigningCertURL":   "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-fake.pem",
+	}
+
+	digest := sha256.Sum256([]byte("Message\n" + content + "\nMessageId\nfake-sns-message-id\nTimestamp\n2023-10-01T12:00:00.000Z\n" +
+		"TopicArn\narn:aws:sns:us-east-1:123456789012:fake-topic\nType\nNotification\n"))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+
+	uts.Require().NoError(err)
+
+	notification["Signature"] = base64.StdEncoding.EncodeToString(signature)
+
+	body, _ := json.Marshal(notification)
+
+	return &sqs.Message{
+		Body:          aws.String(string(body)),
+		ReceiptHandle: aws.String("fake-receipt-handle"),
+		MessageId:     aws.String("fake-message-id"),
+	}
+}
+
+func (uts *UnitTest) newSNSVerificationClient(cert *x509.Certificate, required bool) *consumer.SQSClient {
+	return consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+		SNSVerification: &consumer.SNSVerificationOptions{
+			CertFetcher: &fakeCertFetcher{cert: cert},
+			Required:    required,
+		},
+	})
+}
+
+func (uts *UnitTest) TestSNSVerification_Verifies() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	key, cert := uts.newSigningCert()
+
+	client := uts.newSNSVerificationClient(cert, true)
+
+	client.ProcessMessage(uts.newSignedMessage(key, `{"email": "test@test.com"}`), "https://fake-queue-url")
+
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessage", 1)
+}
+
+func (uts *UnitTest) TestSNSVerification_InvalidSignatureIsBackedOff() {
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	key, _ := uts.newSigningCert()
+	_, otherCert := uts.newSigningCert()
+
+	client := uts.newSNSVerificationClient(otherCert, false)
+
+	uts.PanicsWithError("failed to verify signature of message fake-message-id: crypto/rsa: verification error", func() {
+		client.ProcessMessage(uts.newSignedMessage(key, `{"email": "test@test.com"}`), "https://fake-queue-url")
+	})
+
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "ChangeMessageVisibility", 1)
+	uts.mockSQSService.AssertNotCalled(uts.T(), "DeleteMessage", mock.Anything)
+}
+
+func (uts *UnitTest) TestSNSVerification_Required() {
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	_, cert := uts.newSigningCert()
+
+	client := uts.newSNSVerificationClient(cert, true)
+
+	uts.PanicsWithError("message fake-message-id was not delivered by SNS", func() {
+		client.ProcessMessage(&sqs.Message{
+			Body:          aws.String(`{"email": "test@test.com"}`),
+			ReceiptHandle: aws.String("fake-receipt-handle"),
+			MessageId:     aws.String("fake-message-id"),
+		}, "https://fake-queue-url")
+	})
+}
+
+func (uts *UnitTest) TestSNSVerification_NotRequired() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	_, cert := uts.newSigningCert()
+
+	client := uts.newSNSVerificationClient(cert, false)
+
+	client.ProcessMessage(&sqs.Message{
+		Body:          aws.String(`{"email": "test@test.com"}`),
+		ReceiptHandle: aws.String("fake-receipt-handle"),
+		MessageId:     aws.String("fake-message-id"),
+	}, "https://fake-queue-url")
+
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessage", 1)
+}
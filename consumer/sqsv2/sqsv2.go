@@ -0,0 +1,308 @@
+// Package sqsv2 implements consumer.SQSService with a client of the AWS SDK for Go v2,
+// so the consumer can be used with the credential chains and configuration of the v2 SDK.
+// It is an adapter: consumer.SQSService keeps the input and output types of the v1 SDK, which the calls are converted from and to.
+package sqsv2
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v2sqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	v1aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// API is the subset of the v2 SQS client used by the consumer. *sqs.Client implements it.
+type API interface {
+	GetQueueUrl(ctx context.Context, input *v2sqs.GetQueueUrlInput, optFns ...func(*v2sqs.Options)) (*v2sqs.GetQueueUrlOutput, error)
+	ReceiveMessage(ctx context.Context, input *v2sqs.ReceiveMessageInput, optFns ...func(*v2sqs.Options)) (*v2sqs.ReceiveMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, input *v2sqs.ChangeMessageVisibilityInput, optFns ...func(*v2sqs.Options)) (*v2sqs.ChangeMessageVisibilityOutput, error)
+	DeleteMessage(ctx context.Context, input *v2sqs.DeleteMessageInput, optFns ...func(*v2sqs.Options)) (*v2sqs.DeleteMessageOutput, error)
+	ListQueues(ctx context.Context, input *v2sqs.ListQueuesInput, optFns ...func(*v2sqs.Options)) (*v2sqs.ListQueuesOutput, error)
+	GetQueueAttributes(ctx context.Context, input *v2sqs.GetQueueAttributesInput, optFns ...func(*v2sqs.Options)) (*v2sqs.GetQueueAttributesOutput, error)
+	DeleteMessageBatch(ctx context.Context, input *v2sqs.DeleteMessageBatchInput, optFns ...func(*v2sqs.Options)) (*v2sqs.DeleteMessageBatchOutput, error)
+	ChangeMessageVisibilityBatch(ctx context.Context, input *v2sqs.ChangeMessageVisibilityBatchInput, optFns ...func(*v2sqs.Options)) (*v2sqs.ChangeMessageVisibilityBatchOutput, error)
+	SendMessage(ctx context.Context, input *v2sqs.SendMessageInput, optFns ...func(*v2sqs.Options)) (*v2sqs.SendMessageOutput, error)
+}
+
+// Service translates the calls of the consumer to the v2 client. It implements consumer.SQSService and producer.SQSSender.
+type Service struct {
+	Client API
+	optFns []func(*v2sqs.Options)
+}
+
+// New returns a service backed by client, e.g. sqs.NewFromConfig(cfg). The optFns are applied to every call.
+func New(client API, optFns ...func(*v2sqs.Options)) *Service {
+	return &Service{
+		Client: client,
+		optFns: optFns,
+	}
+}
+
+func (s *Service) GetQueueUrl(input *sqs.GetQueueUrlInput) (*sqs.GetQueueUrlOutput, error) {
+	output, err := s.Client.GetQueueUrl(context.Background(), &v2sqs.GetQueueUrlInput{
+		QueueName:              input.QueueName,
+		QueueOwnerAWSAccountId: input.QueueOwnerAWSAccountId,
+	}, s.optFns...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqs.GetQueueUrlOutput{QueueUrl: output.QueueUrl}, nil
+}
+
+func (s *Service) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	return s.ReceiveMessageWithContext(context.Background(), input)
+}
+
+// ReceiveMessageWithContext receives messages until ctx is done. It implements consumer.ContextReceiver, so the consumer
+// cancels the long poll when it stops. The request options of the v1 SDK are ignored; use the optFns of New instead.
+func (s *Service) ReceiveMessageWithContext(ctx v1aws.Context, input *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	var attributeNames []types.MessageSystemAttributeName
+
+	for _, name := range input.AttributeNames {
+		attributeNames = append(attributeNames, types.MessageSystemAttributeName(*name))
+	}
+
+	output, err := s.Client.ReceiveMessage(ctx, &v2sqs.ReceiveMessageInput{
+		QueueUrl:                    input.QueueUrl,
+		MessageSystemAttributeNames: attributeNames,
+		MaxNumberOfMessages:         int32(v1aws.Int64Value(input.MaxNumberOfMessages)),
+		MessageAttributeNames:       stringValues(input.MessageAttributeNames),
+		ReceiveRequestAttemptId:     input.ReceiveRequestAttemptId,
+		VisibilityTimeout:           int32(v1aws.Int64Value(input.VisibilityTimeout)),
+		WaitTimeSeconds:             int32(v1aws.Int64Value(input.WaitTimeSeconds)),
+	}, s.optFns...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []*sqs.Message{}
+
+	for _, message := range output.Messages {
+		messages = append(messages, &sqs.Message{
+			Attributes:             v1aws.StringMap(message.Attributes),
+			Body:                   message.Body,
+			MD5OfBody:              message.MD5OfBody,
+			MD5OfMessageAttributes: message.MD5OfMessageAttributes,
+			MessageAttributes:      fromMessageAttributes(message.MessageAttributes),
+			MessageId:              message.MessageId,
+			ReceiptHandle:          message.ReceiptHandle,
+		})
+	}
+
+	return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+}
+
+func (s *Service) ChangeMessageVisibility(input *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	_, err := s.Client.ChangeMessageVisibility(context.Background(), &v2sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          input.QueueUrl,
+		ReceiptHandle:     input.ReceiptHandle,
+		VisibilityTimeout: int32(v1aws.Int64Value(input.VisibilityTimeout)),
+	}, s.optFns...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (s *Service) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	_, err := s.Client.DeleteMessage(context.Background(), &v2sqs.DeleteMessageInput{
+		QueueUrl:      input.QueueUrl,
+		ReceiptHandle: input.ReceiptHandle,
+	}, s.optFns...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (s *Service) ListQueues(input *sqs.ListQueuesInput) (*sqs.ListQueuesOutput, error) {
+	v2Input := &v2sqs.ListQueuesInput{
+		NextToken:       input.NextToken,
+		QueueNamePrefix: input.QueueNamePrefix,
+	}
+
+	if input.MaxResults != nil {
+		v2Input.MaxResults = aws.Int32(int32(*input.MaxResults))
+	}
+
+	output, err := s.Client.ListQueues(context.Background(), v2Input, s.optFns...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqs.ListQueuesOutput{
+		NextToken: output.NextToken,
+		QueueUrls: v1aws.StringSlice(output.QueueUrls),
+	}, nil
+}
+
+func (s *Service) GetQueueAttributes(input *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error) {
+	var attributeNames []types.QueueAttributeName
+
+	for _, name := range input.AttributeNames {
+		attributeNames = append(attributeNames, types.QueueAttributeName(*name))
+	}
+
+	output, err := s.Client.GetQueueAttributes(context.Background(), &v2sqs.GetQueueAttributesInput{
+		QueueUrl:       input.QueueUrl,
+		AttributeNames: attributeNames,
+	}, s.optFns...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqs.GetQueueAttributesOutput{Attributes: v1aws.StringMap(output.Attributes)}, nil
+}
+
+func (s *Service) DeleteMessageBatch(input *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error) {
+	entries := []types.DeleteMessageBatchRequestEntry{}
+
+	for _, entry := range input.Entries {
+		entries = append(entries, types.DeleteMessageBatchRequestEntry{
+			Id:            entry.Id,
+			ReceiptHandle: entry.ReceiptHandle,
+		})
+	}
+
+	output, err := s.Client.DeleteMessageBatch(context.Background(), &v2sqs.DeleteMessageBatchInput{
+		QueueUrl: input.QueueUrl,
+		Entries:  entries,
+	}, s.optFns...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &sqs.DeleteMessageBatchOutput{
+		Failed:     fromBatchErrors(output.Failed),
+		Successful: []*sqs.DeleteMessageBatchResultEntry{},
+	}
+
+	for _, entry := range output.Successful {
+		result.Successful = append(result.Successful, &sqs.DeleteMessageBatchResultEntry{Id: entry.Id})
+	}
+
+	return result, nil
+}
+
+func (s *Service) ChangeMessageVisibilityBatch(input *sqs.ChangeMessageVisibilityBatchInput) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	entries := []types.ChangeMessageVisibilityBatchRequestEntry{}
+
+	for _, entry := range input.Entries {
+		entries = append(entries, types.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                entry.Id,
+			ReceiptHandle:     entry.ReceiptHandle,
+			VisibilityTimeout: int32(v1aws.Int64Value(entry.VisibilityTimeout)),
+		})
+	}
+
+	output, err := s.Client.ChangeMessageVisibilityBatch(context.Background(), &v2sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: input.QueueUrl,
+		Entries:  entries,
+	}, s.optFns...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &sqs.ChangeMessageVisibilityBatchOutput{
+		Failed:     fromBatchErrors(output.Failed),
+		Successful: []*sqs.ChangeMessageVisibilityBatchResultEntry{},
+	}
+
+	for _, entry := range output.Successful {
+		result.Successful = append(result.Successful, &sqs.ChangeMessageVisibilityBatchResultEntry{Id: entry.Id})
+	}
+
+	return result, nil
+}
+
+func (s *Service) SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
+	output, err := s.Client.SendMessage(context.Background(), &v2sqs.SendMessageInput{
+		QueueUrl:               input.QueueUrl,
+		MessageBody:            input.MessageBody,
+		DelaySeconds:           int32(v1aws.Int64Value(input.DelaySeconds)),
+		MessageAttributes:      toMessageAttributes(input.MessageAttributes),
+		MessageDeduplicationId: input.MessageDeduplicationId,
+		MessageGroupId:         input.MessageGroupId,
+	}, s.optFns...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqs.SendMessageOutput{
+		MD5OfMessageAttributes: output.MD5OfMessageAttributes,
+		MD5OfMessageBody:       output.MD5OfMessageBody,
+		MessageId:              output.MessageId,
+		SequenceNumber:         output.SequenceNumber,
+	}, nil
+}
+
+func fromMessageAttributes(attributes map[string]types.MessageAttributeValue) map[string]*sqs.MessageAttributeValue {
+	result := make(map[string]*sqs.MessageAttributeValue, len(attributes))
+
+	for key, value := range attributes {
+		result[key] = &sqs.MessageAttributeValue{
+			DataType:         value.DataType,
+			StringValue:      value.StringValue,
+			BinaryValue:      value.BinaryValue,
+			StringListValues: v1aws.StringSlice(value.StringListValues),
+			BinaryListValues: value.BinaryListValues,
+		}
+	}
+
+	return result
+}
+
+func toMessageAttributes(attributes map[string]*sqs.MessageAttributeValue) map[string]types.MessageAttributeValue {
+	result := make(map[string]types.MessageAttributeValue, len(attributes))
+
+	for key, value := range attributes {
+		result[key] = types.MessageAttributeValue{
+			DataType:         value.DataType,
+			StringValue:      value.StringValue,
+			BinaryValue:      value.BinaryValue,
+			StringListValues: stringValues(value.StringListValues),
+			BinaryListValues: value.BinaryListValues,
+		}
+	}
+
+	return result
+}
+
+func fromBatchErrors(entries []types.BatchResultErrorEntry) []*sqs.BatchResultErrorEntry {
+	result := []*sqs.BatchResultErrorEntry{}
+
+	for _, entry := range entries {
+		result = append(result, &sqs.BatchResultErrorEntry{
+			Code:        entry.Code,
+			Id:          entry.Id,
+			Message:     entry.Message,
+			SenderFault: aws.Bool(entry.SenderFault),
+		})
+	}
+
+	return result
+}
+
+// stringValues converts a list of the v1 SDK, keeping it nil when it is empty so it is not sent
+func stringValues(values []*string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	return v1aws.StringValueSlice(values)
+}
@@ -0,0 +1,301 @@
+package sqsv2_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v2sqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	v1aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/inaciogu/go-sqs/consumer/sqsv2"
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeSQS answers the requests of the v2 client, which uses the JSON protocol of SQS, with canned responses by action
+type fakeSQS struct {
+	mu        sync.Mutex
+	responses map[string]string
+	requests  map[string]map[string]interface{}
+	// poll is how long ReceiveMessage waits before answering, like a long poll of an empty queue
+	poll time.Duration
+}
+
+func (f *fakeSQS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.")
+	body, _ := io.ReadAll(r.Body)
+	request := map[string]interface{}{}
+
+	json.Unmarshal(body, &request)
+
+	f.mu.Lock()
+	f.requests[action] = request
+	response, ok := f.responses[action]
+	poll := f.poll
+	f.mu.Unlock()
+
+	if action == "ReceiveMessage" && poll > 0 {
+		select {
+		case <-time.After(poll):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type": "com.amazonaws.sqs#QueueDoesNotExist", "message": "The specified queue does not exist."}`))
+
+		return
+	}
+
+	w.Write([]byte(response))
+}
+
+type UnitTest struct {
+	suite.Suite
+	fake    *fakeSQS
+	server  *httptest.Server
+	service *sqsv2.Service
+}
+
+func (u *UnitTest) SetupTest() {
+	u.fake = &fakeSQS{
+		responses: map[string]string{},
+		requests:  map[string]map[string]interface{}{},
+	}
+	u.server = httptest.NewServer(u.fake)
+
+	client := v2sqs.New(v2sqs.Options{
+		Region:                           "us-east-1",
+		BaseEndpoint:                     aws.String(u.server.URL),
+		Credentials:                      aws.AnonymousCredentials{},
+		RetryMaxAttempts:                 1,
+		DisableMessageChecksumValidation: true,
+	})
+
+	u.service = sqsv2.New(client)
+}
+
+func (u *UnitTest) TearDownTest() {
+	u.server.Close()
+}
+
+func TestUnitSuites(t *testing.T) {
+	suite.Run(t, &UnitTest{})
+}
+
+func (u *UnitTest) TestGetQueueUrl() {
+	u.fake.responses["GetQueueUrl"] = `{"QueueUrl": "https://fake-queue-url/fake-queue-name"}`
+
+	output, err := u.service.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: v1aws.String("fake-queue-name")})
+
+	u.NoError(err)
+	u.Equal("https://fake-queue-url/fake-queue-name", *output.QueueUrl)
+	u.Equal("fake-queue-name", u.fake.requests["GetQueueUrl"]["QueueName"])
+}
+
+func (u *UnitTest) TestGetQueueUrl_Error() {
+	_, err := u.service.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: v1aws.String("fake-queue-name")})
+
+	u.ErrorContains(err, "QueueDoesNotExist")
+}
+
+func (u *UnitTest) TestReceiveMessage() {
+	u.fake.responses["ReceiveMessage"] = `{"Messages": [{
+		"MessageId": "fake-message-id",
+		"ReceiptHandle": "fake-receipt-handle",
+		"Body": "{\"content\": \"fake-content\"}",
+		"Attributes": {"ApproximateReceiveCount": "2"},
+		"MessageAttributes": {"eventType": {"DataType": "String", "StringValue": "order.created"}}
+	}]}`
+
+	output, err := u.service.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:              v1aws.String("https://fake-queue-url/fake-queue-name"),
+		AttributeNames:        []*string{v1aws.String("All")},
+		MessageAttributeNames: []*string{v1aws.String("All")},
+		MaxNumberOfMessages:   v1aws.Int64(10),
+		VisibilityTimeout:     v1aws.Int64(30),
+		WaitTimeSeconds:       v1aws.Int64(20),
+	})
+
+	u.NoError(err)
+	u.Len(output.Messages, 1)
+	u.Equal("fake-message-id", *output.Messages[0].MessageId)
+	u.Equal("fake-receipt-handle", *output.Messages[0].ReceiptHandle)
+	u.Equal(`{"content": "fake-content"}`, *output.Messages[0].Body)
+	u.Equal("2", *output.Messages[0].Attributes["ApproximateReceiveCount"])
+	u.Equal("order.created", *output.Messages[0].MessageAttributes["eventType"].StringValue)
+
+	request := u.fake.requests["ReceiveMessage"]
+
+	u.Equal([]interface{}{"All"}, request["MessageSystemAttributeNames"])
+	u.Equal([]interface{}{"All"}, request["MessageAttributeNames"])
+	u.Equal(float64(10), request["MaxNumberOfMessages"])
+	u.Equal(float64(30), request["VisibilityTimeout"])
+	u.Equal(float64(20), request["WaitTimeSeconds"])
+}
+
+func (u *UnitTest) TestDeleteMessageBatch() {
+	u.fake.responses["DeleteMessageBatch"] = `{
+		"Successful": [{"Id": "0"}],
+		"Failed": [{"Id": "1", "Code": "ReceiptHandleIsInvalid", "Message": "fake-error", "SenderFault": true}]
+	}`
+
+	output, err := u.service.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
+		QueueUrl: v1aws.String("https://fake-queue-url/fake-queue-name"),
+		Entries: []*sqs.DeleteMessageBatchRequestEntry{
+			{Id: v1aws.String("0"), ReceiptHandle: v1aws.String("fake-receipt-handle-0")},
+			{Id: v1aws.String("1"), ReceiptHandle: v1aws.String("fake-receipt-handle-1")},
+		},
+	})
+
+	u.NoError(err)
+	u.Len(output.Successful, 1)
+	u.Equal("0", *output.Successful[0].Id)
+	u.Len(output.Failed, 1)
+	u.Equal("1", *output.Failed[0].Id)
+	u.Equal("fake-error", *output.Failed[0].Message)
+	u.True(*output.Failed[0].SenderFault)
+	u.Len(u.fake.requests["DeleteMessageBatch"]["Entries"], 2)
+}
+
+func (u *UnitTest) TestChangeMessageVisibilityBatch() {
+	u.fake.responses["ChangeMessageVisibilityBatch"] = `{"Successful": [{"Id": "0"}], "Failed": []}`
+
+	output, err := u.service.ChangeMessageVisibilityBatch(&sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: v1aws.String("https://fake-queue-url/fake-queue-name"),
+		Entries: []*sqs.ChangeMessageVisibilityBatchRequestEntry{
+			{Id: v1aws.String("0"), ReceiptHandle: v1aws.String("fake-receipt-handle"), VisibilityTimeout: v1aws.Int64(4)},
+		},
+	})
+
+	u.NoError(err)
+	u.Len(output.Successful, 1)
+	u.Empty(output.Failed)
+
+	entries := u.fake.requests["ChangeMessageVisibilityBatch"]["Entries"].([]interface{})
+
+	u.Equal(float64(4), entries[0].(map[string]interface{})["VisibilityTimeout"])
+}
+
+func (u *UnitTest) TestSendMessage() {
+	u.fake.responses["SendMessage"] = `{"MessageId": "fake-message-id", "MD5OfMessageBody": "fake-md5"}`
+
+	output, err := u.service.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:    v1aws.String("https://fake-queue-url/fake-queue-name"),
+		MessageBody: v1aws.String("fake-body"),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"eventType": {DataType: v1aws.String("String"), StringValue: v1aws.String("order.created")},
+		},
+		MessageGroupId: v1aws.String("fake-group-id"),
+	})
+
+	u.NoError(err)
+	u.Equal("fake-message-id", *output.MessageId)
+
+	request := u.fake.requests["SendMessage"]
+
+	u.Equal("fake-body", request["MessageBody"])
+	u.Equal("fake-group-id", request["MessageGroupId"])
+	u.Equal(map[string]interface{}{"DataType": "String", "StringValue": "order.created"}, request["MessageAttributes"].(map[string]interface{})["eventType"])
+}
+
+func (u *UnitTest) TestListQueuesAndAttributes() {
+	u.fake.responses["ListQueues"] = `{"QueueUrls": ["https://fake-queue-url/fake-queue-1", "https://fake-queue-url/fake-queue-2"]}`
+	u.fake.responses["GetQueueAttributes"] = `{"Attributes": {"ApproximateNumberOfMessages": "5"}}`
+
+	queues, err := u.service.ListQueues(&sqs.ListQueuesInput{QueueNamePrefix: v1aws.String("fake-queue")})
+
+	u.NoError(err)
+	u.Equal([]string{"https://fake-queue-url/fake-queue-1", "https://fake-queue-url/fake-queue-2"}, v1aws.StringValueSlice(queues.QueueUrls))
+
+	attributes, err := u.service.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       v1aws.String("https://fake-queue-url/fake-queue-1"),
+		AttributeNames: []*string{v1aws.String(sqs.QueueAttributeNameApproximateNumberOfMessages)},
+	})
+
+	u.NoError(err)
+	u.Equal("5", *attributes.Attributes["ApproximateNumberOfMessages"])
+	u.Equal([]interface{}{"ApproximateNumberOfMessages"}, u.fake.requests["GetQueueAttributes"]["AttributeNames"])
+}
+
+func (u *UnitTest) TestConsumer() {
+	u.fake.responses["DeleteMessage"] = `{}`
+	u.fake.responses["ChangeMessageVisibility"] = `{}`
+
+	client := consumer.New(u.service, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return message.Content == "handled"
+		},
+	})
+
+	client.ProcessMessage(&sqs.Message{
+		Body:          v1aws.String("handled"),
+		ReceiptHandle: v1aws.String("fake-receipt-handle"),
+		MessageId:     v1aws.String("fake-message-id"),
+	}, "https://fake-queue-url/fake-queue-name")
+
+	u.Equal("fake-receipt-handle", u.fake.requests["DeleteMessage"]["ReceiptHandle"])
+
+	client.ProcessMessage(&sqs.Message{
+		Body:          v1aws.String("failed"),
+		ReceiptHandle: v1aws.String("fake-receipt-handle"),
+		MessageId:     v1aws.String("fake-message-id"),
+		Attributes:    map[string]*string{"ApproximateReceiveCount": v1aws.String("2")},
+	}, "https://fake-queue-url/fake-queue-name")
+
+	u.Equal(float64(4), u.fake.requests["ChangeMessageVisibility"]["VisibilityTimeout"])
+}
+
+func (u *UnitTest) TestReceiveMessageWithContext_Cancelled() {
+	u.fake.responses["ReceiveMessage"] = `{}`
+	u.fake.poll = 20 * time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+
+	_, err := u.service.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:        v1aws.String("https://fake-queue-url/fake-queue-name"),
+		WaitTimeSeconds: v1aws.Int64(20),
+	})
+
+	u.ErrorIs(err, context.DeadlineExceeded)
+	u.Less(time.Since(started), 5*time.Second)
+}
+
+func (u *UnitTest) TestRun_CancelsLongPoll() {
+	u.fake.responses["GetQueueUrl"] = `{"QueueUrl": "https://fake-queue-url/fake-queue-name"}`
+	u.fake.responses["ReceiveMessage"] = `{}`
+	u.fake.poll = 20 * time.Second
+
+	client := consumer.New(u.service, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	started := time.Now()
+
+	u.NoError(client.Run(ctx))
+	u.Less(time.Since(started), 5*time.Second)
+}
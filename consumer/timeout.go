@@ -0,0 +1,76 @@
+package consumer
+
+import (
+	"context"
+	"time"
+)
+
+// detachedContext keeps the values of its parent but is never cancelled, like context.WithoutCancel of Go 1.21
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// callHandler calls handle with a context that is only cancelled once timeout is exceeded, and reports whether handle returned in time.
+// The context keeps the values of ctx, but it is not cancelled with ctx, so the handlers run to completion when the consumer stops.
+// When it times out, handle is left running in the background and its result is ignored, so the worker is freed.
+// A panic in handle is propagated to the caller. When timeout is zero, handle is called without a deadline.
+func callHandler[T any](ctx context.Context, timeout time.Duration, handle func(ctx context.Context) T) (T, bool) {
+	ctx = detachedContext{parent: ctx}
+
+	if timeout == 0 {
+		return handle(ctx), true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		result T
+		panic  interface{}
+	}
+
+	done := make(chan outcome, 1)
+
+	go func() {
+		var o outcome
+
+		defer func() {
+			o.panic = recover()
+			done <- o
+		}()
+
+		o.result = handle(ctx)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case o := <-done:
+		if o.panic != nil {
+			panic(o.panic)
+		}
+
+		return o.result, true
+	case <-timer.C:
+		var zero T
+
+		return zero, false
+	}
+}
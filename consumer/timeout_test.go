@@ -0,0 +1,218 @@
+package consumer_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTimeoutMessage() *sqs.Message {
+	return &sqs.Message{
+		Body:          aws.String(`{"content": "fake-content"}`),
+		ReceiptHandle: aws.String("fake-receipt-handle"),
+		MessageId:     aws.String("fake-message-id"),
+		Attributes: map[string]*string{
+			"ApproximateReceiveCount": aws.String("1"),
+		},
+	}
+}
+
+func (uts *UnitTest) TestHandlerTimeout_CancelsAndBacksOff() {
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	cancelled := make(chan struct{})
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			<-message.Context().Done()
+
+			close(cancelled)
+
+			return true
+		},
+		HandlerTimeout: 50 * time.Millisecond,
+	})
+
+	client.ProcessMessage(newTimeoutMessage(), "https://fake-queue-url")
+
+	uts.Eventually(func() bool {
+		select {
+		case <-cancelled:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+	uts.mockSQSService.AssertCalled(uts.T(), "ChangeMessageVisibility", &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String("https://fake-queue-url"),
+		ReceiptHandle:     aws.String("fake-receipt-handle"),
+		VisibilityTimeout: aws.Int64(2),
+	})
+	uts.mockSQSService.AssertNotCalled(uts.T(), "DeleteMessage", mock.Anything)
+}
+
+func (uts *UnitTest) TestHandlerTimeout_ContextIsNotCancelledOnStop() {
+	uts.mockSQSService.On("GetQueueUrl", mock.Anything).Return(&sqs.GetQueueUrlOutput{
+		QueueUrl: aws.String("https://fake-queue-url/fake-queue-name"),
+	}, nil)
+	uts.mockSQSService.On("ReceiveMessage", mock.Anything).Return(&sqs.ReceiveMessageOutput{
+		Messages: []*sqs.Message{newTimeoutMessage()},
+	}, nil)
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	var cancelled atomic.Value
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			// The consumer is stopped while the message is handled
+			time.Sleep(300 * time.Millisecond)
+
+			cancelled.Store(message.Context().Err() != nil)
+
+			return true
+		},
+		HandlerTimeout: time.Second,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(600*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Equal(false, cancelled.Load())
+	uts.mockSQSService.AssertCalled(uts.T(), "DeleteMessage", mock.Anything)
+}
+
+func (uts *UnitTest) TestHandlerTimeout_NotExceeded() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			return message.Context().Err() == nil
+		},
+		HandlerTimeout: time.Second,
+	})
+
+	client.ProcessMessage(newTimeoutMessage(), "https://fake-queue-url")
+
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessage", 1)
+}
+
+func (uts *UnitTest) TestHandlerTimeout_PropagatesPanic() {
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			panic("fake-panic")
+		},
+		HandlerTimeout: time.Second,
+	})
+
+	uts.PanicsWithValue("fake-panic", func() {
+		client.ProcessMessage(newTimeoutMessage(), "https://fake-queue-url")
+	})
+}
+
+func (uts *UnitTest) TestHandlerTimeout_FreesWorker() {
+	uts.setupBatchMocks(1, 2)
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	var calls int32
+
+	release := make(chan struct{})
+	defer close(release)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			atomic.AddInt32(&calls, 1)
+
+			// The handler ignores its context, so only the timeout frees the worker
+			<-release
+
+			return true
+		},
+		Workers:        1,
+		HandlerTimeout: 100 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(700*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Equal(int32(2), atomic.LoadInt32(&calls))
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "ChangeMessageVisibility", 2)
+	uts.mockSQSService.AssertNotCalled(uts.T(), "DeleteMessage", mock.Anything)
+}
+
+func (uts *UnitTest) TestHandlerTimeout_Batch() {
+	uts.setupBatchMocks(1, 3)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		HandleBatch: func(ctx context.Context, messages []*message.Message) consumer.BatchResult {
+			<-ctx.Done()
+
+			return consumer.BatchResult{}
+		},
+		HandlerTimeout: 50 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(700*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.mockSQSService.AssertCalled(uts.T(), "ChangeMessageVisibilityBatch", mock.MatchedBy(func(input *sqs.ChangeMessageVisibilityBatchInput) bool {
+		return len(input.Entries) == 3
+	}))
+	uts.mockSQSService.AssertNotCalled(uts.T(), "DeleteMessageBatch", mock.Anything)
+}
+
+func (uts *UnitTest) TestHandlerTimeout_BatchMessageContext() {
+	uts.setupBatchMocks(1, 3)
+
+	cancelled := make(chan int, 1)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		HandleBatch: func(ctx context.Context, messages []*message.Message) consumer.BatchResult {
+			<-ctx.Done()
+
+			count := 0
+
+			// The messages carry the context of the handler, so the middlewares using message.Context are cancelled with it
+			for _, message := range messages {
+				if message.Context().Err() != nil {
+					count++
+				}
+			}
+
+			cancelled <- count
+
+			return consumer.BatchResult{}
+		},
+		HandlerTimeout: 50 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(700*time.Millisecond, cancel)
+
+	uts.NoError(client.Run(ctx))
+
+	uts.Require().NotEmpty(cancelled)
+	uts.Equal(3, <-cancelled)
+}
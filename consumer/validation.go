@@ -0,0 +1,325 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/codec"
+	"github.com/inaciogu/go-sqs/compression"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/inaciogu/go-sqs/encryption"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// PoisonAction is what happens to the messages that do not match their schema
+type PoisonAction int
+
+const (
+	// PoisonHold keeps the invalid messages in the queue, invisible for HoldTimeout, so they can be inspected without being retried
+	PoisonHold PoisonAction = iota
+	// PoisonDelete deletes the invalid messages
+	PoisonDelete
+	// PoisonDeadLetter moves the invalid messages to DeadLetterQueueUrl, with the validation errors in the validation-errors attribute
+	PoisonDeadLetter
+)
+
+const (
+	// ValidationErrorsAttribute is the message attribute that holds the validation errors of the messages moved to the dead-letter queue
+	ValidationErrorsAttribute = "validation-errors"
+	// MaxVisibilityTimeout is the maximum time a message can stay invisible after it was received, as enforced by SQS
+	MaxVisibilityTimeout = 12 * time.Hour
+	// maxMessageAttributes is the maximum number of message attributes of SQS
+	maxMessageAttributes = 10
+)
+
+type ValidationOptions struct {
+	// QueueSchemas maps queue names to the JSON Schema of their messages
+	QueueSchemas map[string]string
+	// EventTypeAttribute is the message attribute holding the event type used to pick a schema from EventSchemas
+	EventTypeAttribute string
+	// EventSchemas maps event types to the JSON Schema of their messages. They take precedence over QueueSchemas.
+	EventSchemas map[string]string
+	// PoisonAction is what happens to the invalid messages. Defaults to PoisonHold.
+	PoisonAction PoisonAction
+	// DeadLetterQueueUrl receives the invalid messages when PoisonAction is PoisonDeadLetter
+	DeadLetterQueueUrl string
+	// HoldTimeout is how long the invalid messages stay invisible when PoisonAction is PoisonHold.
+	// It defaults to, and is limited to, MaxVisibilityTimeout minus the VisibilityTimeout of the client, since SQS rejects
+	// visibility timeouts past 12 hours from the receipt of the message.
+	HoldTimeout time.Duration
+}
+
+func setDefaultValidationOptions(options *ValidationOptions, visibilityTimeout int64) {
+	// The message may have been received up to VisibilityTimeout ago
+	maxHoldTimeout := MaxVisibilityTimeout - time.Duration(visibilityTimeout)*time.Second
+
+	if options.HoldTimeout == 0 || options.HoldTimeout > maxHoldTimeout {
+		options.HoldTimeout = maxHoldTimeout
+	}
+}
+
+// decodingAttributes are the attributes needed to decode the content of the messages
+var decodingAttributes = map[string]bool{
+	codec.ContentTypeAttribute:    true,
+	compression.EncodingAttribute: true,
+	encryption.KeyIdAttribute:     true,
+	encryption.DataKeyAttribute:   true,
+	encryption.AlgorithmAttribute: true,
+}
+
+// validator validates the content of the messages against the schema of their event type or queue
+type validator struct {
+	eventTypeAttribute string
+	queues             map[string]*jsonschema.Schema
+	events             map[string]*jsonschema.Schema
+}
+
+func newValidator(options *ValidationOptions) (*validator, error) {
+	if options.PoisonAction == PoisonDeadLetter && options.DeadLetterQueueUrl == "" {
+		return nil, fmt.Errorf("DeadLetterQueueUrl is required with PoisonDeadLetter")
+	}
+
+	queues, err := compileSchemas("queue", options.QueueSchemas)
+
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := compileSchemas("event", options.EventSchemas)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &validator{
+		eventTypeAttribute: options.EventTypeAttribute,
+		queues:             queues,
+		events:             events,
+	}, nil
+}
+
+func compileSchemas(kind string, schemas map[string]string) (map[string]*jsonschema.Schema, error) {
+	compiled := make(map[string]*jsonschema.Schema, len(schemas))
+
+	for name, schema := range schemas {
+		result, err := jsonschema.CompileString(fmt.Sprintf("%s/%s.json", kind, name), schema)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema of %s %s: %w", kind, name, err)
+		}
+
+		compiled[name] = result
+	}
+
+	return compiled, nil
+}
+
+// validate returns the validation errors of the message, or nil when it is valid or has no schema
+func (v *validator) validate(queueName string, message *message.Message) []string {
+	schema, ok := v.events[message.Metadata.MessageAttributes[v.eventTypeAttribute]]
+
+	if !ok || v.eventTypeAttribute == "" {
+		schema, ok = v.queues[queueName]
+	}
+
+	if !ok {
+		return nil
+	}
+
+	messageCodec, err := message.ContentCodec()
+
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	// Protobuf contents can not be decoded without their Go type, so they have nothing to validate a JSON Schema against
+	if messageCodec.ContentType() == codec.Protobuf.ContentType() {
+		return nil
+	}
+
+	content, err := decodeContent(messageCodec, message.Content)
+
+	if err != nil {
+		return []string{fmt.Sprintf("invalid %s content: %s", messageCodec.ContentType(), err.Error())}
+	}
+
+	err = schema.Validate(content)
+
+	if err == nil {
+		return nil
+	}
+
+	validationErr, ok := err.(*jsonschema.ValidationError)
+
+	if !ok {
+		return []string{err.Error()}
+	}
+
+	errs := []string{}
+
+	for _, cause := range validationErr.BasicOutput().Errors {
+		// Only the leaves describe what is wrong, the other errors just point to the failing subschemas
+		if strings.HasPrefix(cause.Error, "doesn't validate with") || cause.Error == "" {
+			continue
+		}
+
+		location := cause.InstanceLocation
+
+		if location == "" {
+			location = "/"
+		}
+
+		errs = append(errs, fmt.Sprintf("%s: %s", location, cause.Error))
+	}
+
+	sort.Strings(errs)
+
+	return errs
+}
+
+// decodeContent decodes the content with its codec into the values of encoding/json, which are the ones understood by the schemas,
+// e.g. the integers and the maps of MessagePack are converted to float64 and map[string]interface{}
+func decodeContent(messageCodec codec.Codec, content string) (interface{}, error) {
+	var decoded interface{}
+
+	if err := codec.Decode(messageCodec, content, &decoded); err != nil {
+		return nil, err
+	}
+
+	if messageCodec.ContentType() == codec.JSON.ContentType() {
+		return decoded, nil
+	}
+
+	data, err := json.Marshal(decoded)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+
+	return value, json.Unmarshal(data, &value)
+}
+
+func (s *SQSClient) setValidator() {
+	if s.ClientOptions.Validation == nil {
+		return
+	}
+
+	validator, err := newValidator(s.ClientOptions.Validation)
+
+	if err != nil {
+		panic(err)
+	}
+
+	s.validator = validator
+}
+
+// validateMessage reports whether the message is valid. Invalid messages are held, deleted or moved to the dead-letter queue.
+func (s *SQSClient) validateMessage(sqsMessage *sqs.Message, message *message.Message, queueUrl string) (bool, error) {
+	if s.validator == nil {
+		return true, nil
+	}
+
+	errs := s.validator.validate(getQueueName(queueUrl), message)
+
+	if errs == nil {
+		return true, nil
+	}
+
+	s.Logger.Log("message %s is invalid: %s", message.Metadata.MessageId, strings.Join(errs, "; "))
+
+	return false, s.handlePoison(sqsMessage, queueUrl, errs)
+}
+
+func (s *SQSClient) handlePoison(sqsMessage *sqs.Message, queueUrl string, errs []string) error {
+	options := s.ClientOptions.Validation
+
+	switch options.PoisonAction {
+	case PoisonDelete:
+	case PoisonDeadLetter:
+		attributes := s.deadLetterAttributes(sqsMessage)
+
+		attributes[ValidationErrorsAttribute] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(strings.Join(errs, "; ")),
+		}
+
+		input := &sqs.SendMessageInput{
+			QueueUrl:          aws.String(options.DeadLetterQueueUrl),
+			MessageBody:       sqsMessage.Body,
+			MessageAttributes: attributes,
+		}
+
+		// FIFO queues require a group, and a deduplication ID unless content-based deduplication is enabled
+		if strings.HasSuffix(options.DeadLetterQueueUrl, ".fifo") {
+			input.MessageGroupId = sqsMessage.Attributes[sqs.MessageSystemAttributeNameMessageGroupId]
+
+			if aws.StringValue(input.MessageGroupId) == "" {
+				input.MessageGroupId = sqsMessage.MessageId
+			}
+
+			input.MessageDeduplicationId = sqsMessage.MessageId
+		}
+
+		_, err := s.Client.SendMessage(input)
+
+		if err != nil {
+			return err
+		}
+	default:
+		_, err := s.Client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(queueUrl),
+			ReceiptHandle:     sqsMessage.ReceiptHandle,
+			VisibilityTimeout: aws.Int64(int64(options.HoldTimeout.Seconds())),
+		})
+
+		return err
+	}
+
+	_, err := s.Client.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(queueUrl),
+		ReceiptHandle: sqsMessage.ReceiptHandle,
+	})
+
+	return err
+}
+
+// deadLetterAttributes copies the attributes of the message sent to the dead-letter queue, leaving room for the validation errors
+// within the attribute limit of SQS. The attributes needed to decode the message are kept first.
+func (s *SQSClient) deadLetterAttributes(sqsMessage *sqs.Message) map[string]*sqs.MessageAttributeValue {
+	keys := []string{}
+
+	for key := range sqsMessage.MessageAttributes {
+		if key != ValidationErrorsAttribute {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		if decodingAttributes[keys[i]] != decodingAttributes[keys[j]] {
+			return decodingAttributes[keys[i]]
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	if len(keys) > maxMessageAttributes-1 {
+		s.Logger.Log("dropping attributes %s of message %s sent to the dead-letter queue", strings.Join(keys[maxMessageAttributes-1:], ", "), aws.StringValue(sqsMessage.MessageId))
+
+		keys = keys[:maxMessageAttributes-1]
+	}
+
+	attributes := make(map[string]*sqs.MessageAttributeValue, len(keys)+1)
+
+	for _, key := range keys {
+		attributes[key] = sqsMessage.MessageAttributes[key]
+	}
+
+	return attributes
+}
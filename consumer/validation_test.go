@@ -0,0 +1,340 @@
+package consumer_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/codec"
+	"github.com/inaciogu/go-sqs/consumer"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"properties": {
+		"id": {"type": "integer"},
+		"email": {"type": "string"}
+	},
+	"required": ["id", "email"]
+}`
+
+const cancellationSchema = `{
+	"type": "object",
+	"properties": {
+		"reason": {"type": "string"}
+	},
+	"required": ["reason"]
+}`
+
+func newValidationMessage(body string, eventType string) *sqs.Message {
+	sqsMessage := &sqs.Message{
+		Body:              aws.String(body),
+		ReceiptHandle:     aws.String("fake-receipt-handle"),
+		MessageId:         aws.String("fake-message-id"),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{},
+	}
+
+	if eventType != "" {
+		sqsMessage.MessageAttributes["eventType"] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(eventType),
+		}
+	}
+
+	return sqsMessage
+}
+
+// newValidationClient returns a client that counts the messages passed to Handle
+func (uts *UnitTest) newValidationClient(options consumer.ValidationOptions, calls *int) *consumer.SQSClient {
+	return consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName: "fake-queue-name",
+		Handle: func(message *message.Message) bool {
+			*calls++
+
+			return true
+		},
+		Validation: &options,
+	})
+}
+
+func (uts *UnitTest) TestValidation_Valid() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	calls := 0
+
+	client := uts.newValidationClient(consumer.ValidationOptions{
+		QueueSchemas: map[string]string{"fake-queue-name": orderSchema},
+	}, &calls)
+
+	client.ProcessMessage(newValidationMessage(`{"id": 1, "email": "test@test.com"}`, ""), "https://fake-queue-url/fake-queue-name")
+
+	uts.Equal(1, calls)
+}
+
+func (uts *UnitTest) TestValidation_Hold() {
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	calls := 0
+
+	client := uts.newValidationClient(consumer.ValidationOptions{
+		QueueSchemas: map[string]string{"fake-queue-name": orderSchema},
+	}, &calls)
+
+	client.ProcessMessage(newValidationMessage(`{"id": "1"}`, ""), "https://fake-queue-url/fake-queue-name")
+
+	uts.Equal(0, calls)
+	uts.mockSQSService.AssertCalled(uts.T(), "ChangeMessageVisibility", &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String("https://fake-queue-url/fake-queue-name"),
+		ReceiptHandle:     aws.String("fake-receipt-handle"),
+		VisibilityTimeout: aws.Int64(43170),
+	})
+	uts.mockSQSService.AssertNotCalled(uts.T(), "DeleteMessage", mock.Anything)
+}
+
+func (uts *UnitTest) TestValidation_HoldTimeoutIsLimited() {
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	client := consumer.New(uts.mockSQSService, consumer.SQSClientOptions{
+		QueueName:         "fake-queue-name",
+		VisibilityTimeout: 600,
+		Handle: func(message *message.Message) bool {
+			return true
+		},
+		Validation: &consumer.ValidationOptions{
+			QueueSchemas: map[string]string{"fake-queue-name": orderSchema},
+			HoldTimeout:  24 * time.Hour,
+		},
+	})
+
+	client.ProcessMessage(newValidationMessage(`{"id": "1"}`, ""), "https://fake-queue-url/fake-queue-name")
+
+	uts.Equal(12*time.Hour-10*time.Minute, client.ClientOptions.Validation.HoldTimeout)
+	uts.mockSQSService.AssertCalled(uts.T(), "ChangeMessageVisibility", mock.MatchedBy(func(input *sqs.ChangeMessageVisibilityInput) bool {
+		return *input.VisibilityTimeout == 42600
+	}))
+}
+
+func (uts *UnitTest) TestValidation_Delete() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	calls := 0
+
+	client := uts.newValidationClient(consumer.ValidationOptions{
+		QueueSchemas: map[string]string{"fake-queue-name": orderSchema},
+		PoisonAction: consumer.PoisonDelete,
+	}, &calls)
+
+	client.ProcessMessage(newValidationMessage(`not json`, ""), "https://fake-queue-url/fake-queue-name")
+
+	uts.Equal(0, calls)
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessage", 1)
+}
+
+// newEncodedValidationMessage returns a message whose body is v encoded with the codec, with its content-type attribute
+func (uts *UnitTest) newEncodedValidationMessage(messageCodec codec.Codec, v interface{}) *sqs.Message {
+	body, err := codec.Encode(messageCodec, v)
+
+	uts.Require().NoError(err)
+
+	sqsMessage := newValidationMessage(body, "")
+	sqsMessage.MessageAttributes[codec.ContentTypeAttribute] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(messageCodec.ContentType()),
+	}
+
+	return sqsMessage
+}
+
+func (uts *UnitTest) TestValidation_MessagePack() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	calls := 0
+
+	client := uts.newValidationClient(consumer.ValidationOptions{
+		QueueSchemas: map[string]string{"fake-queue-name": orderSchema},
+		PoisonAction: consumer.PoisonDelete,
+	}, &calls)
+
+	client.ProcessMessage(uts.newEncodedValidationMessage(codec.MessagePack, map[string]interface{}{
+		"id":    1,
+		"email": "test@test.com",
+	}), "https://fake-queue-url/fake-queue-name")
+
+	uts.Equal(1, calls)
+
+	client.ProcessMessage(uts.newEncodedValidationMessage(codec.MessagePack, map[string]interface{}{
+		"id": "fake-id",
+	}), "https://fake-queue-url/fake-queue-name")
+
+	uts.Equal(1, calls)
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessage", 2)
+}
+
+func (uts *UnitTest) TestValidation_Protobuf() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	calls := 0
+
+	client := uts.newValidationClient(consumer.ValidationOptions{
+		QueueSchemas: map[string]string{"fake-queue-name": orderSchema},
+		PoisonAction: consumer.PoisonDelete,
+	}, &calls)
+
+	client.ProcessMessage(uts.newEncodedValidationMessage(codec.Protobuf, wrapperspb.String("fake-content")), "https://fake-queue-url/fake-queue-name")
+
+	uts.Equal(1, calls)
+}
+
+func (uts *UnitTest) TestValidation_UnknownContentType() {
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	calls := 0
+
+	client := uts.newValidationClient(consumer.ValidationOptions{
+		QueueSchemas: map[string]string{"fake-queue-name": orderSchema},
+	}, &calls)
+
+	sqsMessage := newValidationMessage(`{"id": 1, "email": "test@test.com"}`, "")
+	sqsMessage.MessageAttributes[codec.ContentTypeAttribute] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String("application/avro"),
+	}
+
+	client.ProcessMessage(sqsMessage, "https://fake-queue-url/fake-queue-name")
+
+	uts.Equal(0, calls)
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "ChangeMessageVisibility", 1)
+}
+
+func (uts *UnitTest) TestValidation_DeadLetter() {
+	uts.mockSQSService.On("SendMessage", mock.Anything).Return(&sqs.SendMessageOutput{}, nil)
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	calls := 0
+
+	client := uts.newValidationClient(consumer.ValidationOptions{
+		QueueSchemas:       map[string]string{"fake-queue-name": orderSchema},
+		PoisonAction:       consumer.PoisonDeadLetter,
+		DeadLetterQueueUrl: "https://fake-queue-url/fake-dlq",
+	}, &calls)
+
+	client.ProcessMessage(newValidationMessage(`{"id": "1"}`, "order.created"), "https://fake-queue-url/fake-queue-name")
+
+	uts.Equal(0, calls)
+	uts.mockSQSService.AssertCalled(uts.T(), "SendMessage", mock.MatchedBy(func(input *sqs.SendMessageInput) bool {
+		return *input.QueueUrl == "https://fake-queue-url/fake-dlq" &&
+			*input.MessageBody == `{"id": "1"}` &&
+			*input.MessageAttributes["eventType"].StringValue == "order.created" &&
+			*input.MessageAttributes["validation-errors"].StringValue == "/: missing properties: 'email'; /id: expected integer, but got string"
+	}))
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "DeleteMessage", 1)
+}
+
+func (uts *UnitTest) TestValidation_DeadLetterAttributeLimit() {
+	uts.mockSQSService.On("SendMessage", mock.Anything).Return(&sqs.SendMessageOutput{}, nil)
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	calls := 0
+
+	client := uts.newValidationClient(consumer.ValidationOptions{
+		QueueSchemas:       map[string]string{"fake-queue-name": orderSchema},
+		PoisonAction:       consumer.PoisonDeadLetter,
+		DeadLetterQueueUrl: "https://fake-queue-url/fake-dlq",
+	}, &calls)
+
+	sqsMessage := newValidationMessage(`{"id": "1"}`, "")
+
+	for i := 0; i < 10; i++ {
+		sqsMessage.MessageAttributes[fmt.Sprintf("attribute-%d", i)] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String("fake-value")}
+	}
+
+	sqsMessage.MessageAttributes["content-type"] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String("application/json")}
+
+	client.ProcessMessage(sqsMessage, "https://fake-queue-url/fake-queue-name")
+
+	uts.mockSQSService.AssertCalled(uts.T(), "SendMessage", mock.MatchedBy(func(input *sqs.SendMessageInput) bool {
+		_, first := input.MessageAttributes["attribute-0"]
+		_, last := input.MessageAttributes["attribute-9"]
+
+		return len(input.MessageAttributes) == 10 &&
+			input.MessageAttributes["content-type"] != nil &&
+			input.MessageAttributes["validation-errors"] != nil &&
+			first && !last
+	}))
+}
+
+func (uts *UnitTest) TestValidation_DeadLetterFIFO() {
+	uts.mockSQSService.On("SendMessage", mock.Anything).Return(&sqs.SendMessageOutput{}, nil)
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	calls := 0
+
+	client := uts.newValidationClient(consumer.ValidationOptions{
+		QueueSchemas:       map[string]string{"fake-queue-name.fifo": orderSchema},
+		PoisonAction:       consumer.PoisonDeadLetter,
+		DeadLetterQueueUrl: "https://fake-queue-url/fake-dlq.fifo",
+	}, &calls)
+
+	sqsMessage := newValidationMessage(`{"id": "1"}`, "")
+	sqsMessage.Attributes = map[string]*string{"MessageGroupId": aws.String("fake-group-id")}
+
+	client.ProcessMessage(sqsMessage, "https://fake-queue-url/fake-queue-name.fifo")
+
+	uts.mockSQSService.AssertCalled(uts.T(), "SendMessage", mock.MatchedBy(func(input *sqs.SendMessageInput) bool {
+		return *input.MessageGroupId == "fake-group-id" && *input.MessageDeduplicationId == "fake-message-id"
+	}))
+}
+
+func (uts *UnitTest) TestValidation_EventSchemas() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+	uts.mockSQSService.On("ChangeMessageVisibility", mock.Anything).Return(&sqs.ChangeMessageVisibilityOutput{}, nil)
+
+	calls := 0
+
+	client := uts.newValidationClient(consumer.ValidationOptions{
+		QueueSchemas:       map[string]string{"fake-queue-name": orderSchema},
+		EventTypeAttribute: "eventType",
+		EventSchemas:       map[string]string{"order.cancelled": cancellationSchema},
+	}, &calls)
+
+	// The schema of the event type takes precedence over the schema of the queue
+	client.ProcessMessage(newValidationMessage(`{"reason": "fake-reason"}`, "order.cancelled"), "https://fake-queue-url/fake-queue-name")
+	client.ProcessMessage(newValidationMessage(`{"id": 1}`, "order.cancelled"), "https://fake-queue-url/fake-queue-name")
+	// Events without a schema fall back to the schema of the queue
+	client.ProcessMessage(newValidationMessage(`{"id": 1, "email": "test@test.com"}`, "order.created"), "https://fake-queue-url/fake-queue-name")
+
+	uts.Equal(2, calls)
+	uts.mockSQSService.AssertNumberOfCalls(uts.T(), "ChangeMessageVisibility", 1)
+}
+
+func (uts *UnitTest) TestValidation_WithoutSchema() {
+	uts.mockSQSService.On("DeleteMessage", mock.Anything).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	calls := 0
+
+	client := uts.newValidationClient(consumer.ValidationOptions{
+		QueueSchemas: map[string]string{"other-queue-name": orderSchema},
+	}, &calls)
+
+	client.ProcessMessage(newValidationMessage(`not json`, ""), "https://fake-queue-url/fake-queue-name")
+
+	uts.Equal(1, calls)
+}
+
+func (uts *UnitTest) TestValidation_InvalidOptions() {
+	uts.Panics(func() {
+		uts.newValidationClient(consumer.ValidationOptions{
+			QueueSchemas: map[string]string{"fake-queue-name": `{"type": "unknown"}`},
+		}, new(int))
+	})
+
+	uts.Panics(func() {
+		uts.newValidationClient(consumer.ValidationOptions{
+			PoisonAction: consumer.PoisonDeadLetter,
+		}, new(int))
+	})
+}
@@ -0,0 +1,146 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+const (
+	// KeyIdAttribute is the message attribute that holds the ID of the master key that encrypted the data key
+	KeyIdAttribute = "encryption-key-id"
+	// DataKeyAttribute is the message attribute that holds the encrypted data key, base64-encoded
+	DataKeyAttribute = "encryption-data-key"
+	// AlgorithmAttribute is the message attribute that holds the algorithm used to encrypt the body
+	AlgorithmAttribute = "encryption-algorithm"
+	// Algorithm is the only supported algorithm
+	Algorithm = "AES-256-GCM"
+)
+
+// dataKeySize is the size of the AES-256 data keys
+const dataKeySize = 32
+
+// KeyProvider generates and decrypts the data keys used to encrypt the message bodies (envelope encryption)
+type KeyProvider interface {
+	// KeyId identifies the master key of the provider
+	KeyId() string
+	// GenerateDataKey returns a new 256-bit data key in plaintext and encrypted with the master key
+	GenerateDataKey(ctx context.Context) (plaintext []byte, encrypted []byte, err error)
+	// DecryptDataKey decrypts a data key encrypted with the master key identified by keyId
+	DecryptDataKey(ctx context.Context, keyId string, encrypted []byte) ([]byte, error)
+}
+
+// Encrypted reports whether the attributes describe an encrypted body
+func Encrypted(attributes map[string]string) bool {
+	_, ok := attributes[AlgorithmAttribute]
+
+	return ok
+}
+
+// Encrypt encrypts the body with a new data key. It returns the base64-encoded ciphertext and the attributes needed to decrypt it.
+func Encrypt(ctx context.Context, provider KeyProvider, body string) (string, map[string]string, error) {
+	plaintext, encrypted, err := provider.GenerateDataKey(ctx)
+
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	ciphertext, err := seal(plaintext, []byte(body), []byte(provider.KeyId()))
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	attributes := map[string]string{
+		KeyIdAttribute:     provider.KeyId(),
+		DataKeyAttribute:   base64.StdEncoding.EncodeToString(encrypted),
+		AlgorithmAttribute: Algorithm,
+	}
+
+	return base64.StdEncoding.EncodeToString(ciphertext), attributes, nil
+}
+
+// Decrypt decrypts a body encrypted by Encrypt with the attributes it returned
+func Decrypt(ctx context.Context, provider KeyProvider, body string, attributes map[string]string) (string, error) {
+	if algorithm := attributes[AlgorithmAttribute]; algorithm != Algorithm {
+		return "", fmt.Errorf("unknown encryption algorithm %s", algorithm)
+	}
+
+	keyId := attributes[KeyIdAttribute]
+
+	encrypted, err := base64.StdEncoding.DecodeString(attributes[DataKeyAttribute])
+
+	if err != nil {
+		return "", fmt.Errorf("failed to decode data key: %w", err)
+	}
+
+	plaintext, err := provider.DecryptDataKey(ctx, keyId, encrypted)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(body)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted body: %w", err)
+	}
+
+	content, err := open(plaintext, ciphertext, []byte(keyId))
+
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt body: %w", err)
+	}
+
+	return string(content), nil
+}
+
+// seal encrypts the data with AES-GCM, prepending the random nonce to the ciphertext
+func seal(key []byte, data []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, data, additionalData), nil
+}
+
+// open decrypts data encrypted by seal
+func open(key []byte, data []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("invalid key size %d, expected %d bytes", len(key), dataKeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,87 @@
+package encryption_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/inaciogu/go-sqs/encryption"
+	"github.com/stretchr/testify/suite"
+)
+
+type UnitTest struct {
+	suite.Suite
+	provider *encryption.StaticKeyProvider
+}
+
+func (u *UnitTest) SetupTest() {
+	provider, err := encryption.NewStaticKeyProvider("fake-key-id", bytes.Repeat([]byte("k"), 32))
+
+	u.Require().NoError(err)
+
+	u.provider = provider
+}
+
+func TestUnitSuites(t *testing.T) {
+	suite.Run(t, &UnitTest{})
+}
+
+func (u *UnitTest) TestEncryptAndDecrypt() {
+	ctx := context.Background()
+
+	body, attributes, err := encryption.Encrypt(ctx, u.provider, `{"email": "test@test.com"}`)
+
+	u.NoError(err)
+	u.NotContains(body, "test@test.com")
+	u.Equal("fake-key-id", attributes[encryption.KeyIdAttribute])
+	u.Equal(encryption.Algorithm, attributes[encryption.AlgorithmAttribute])
+	u.NotEmpty(attributes[encryption.DataKeyAttribute])
+	u.True(encryption.Encrypted(attributes))
+
+	content, err := encryption.Decrypt(ctx, u.provider, body, attributes)
+
+	u.NoError(err)
+	u.Equal(`{"email": "test@test.com"}`, content)
+}
+
+func (u *UnitTest) TestEveryMessageHasItsOwnDataKey() {
+	ctx := context.Background()
+
+	first, firstAttributes, _ := encryption.Encrypt(ctx, u.provider, "fake-content")
+	second, secondAttributes, _ := encryption.Encrypt(ctx, u.provider, "fake-content")
+
+	u.NotEqual(first, second)
+	u.NotEqual(firstAttributes[encryption.DataKeyAttribute], secondAttributes[encryption.DataKeyAttribute])
+}
+
+func (u *UnitTest) TestDecrypt_TamperedBody() {
+	ctx := context.Background()
+
+	body, attributes, _ := encryption.Encrypt(ctx, u.provider, "fake-content")
+	other, _, _ := encryption.Encrypt(ctx, u.provider, "fake-content")
+
+	_, err := encryption.Decrypt(ctx, u.provider, other, attributes)
+	u.ErrorContains(err, "failed to decrypt body")
+
+	_, err = encryption.Decrypt(ctx, u.provider, "not base64!", attributes)
+	u.ErrorContains(err, "failed to decode encrypted body")
+
+	attributes[encryption.KeyIdAttribute] = "other-key-id"
+
+	_, err = encryption.Decrypt(ctx, u.provider, body, attributes)
+	u.EqualError(err, "failed to decrypt data key: unknown key other-key-id")
+}
+
+func (u *UnitTest) TestDecrypt_UnknownAlgorithm() {
+	_, err := encryption.Decrypt(context.Background(), u.provider, "fake-content", map[string]string{
+		encryption.AlgorithmAttribute: "DES",
+	})
+
+	u.EqualError(err, "unknown encryption algorithm DES")
+}
+
+func (u *UnitTest) TestStaticKeyProvider_InvalidKey() {
+	_, err := encryption.NewStaticKeyProvider("fake-key-id", []byte("short"))
+
+	u.EqualError(err, "invalid key size 5, expected 32 bytes")
+}
@@ -0,0 +1,56 @@
+package encryption
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// KMSAPI is the subset of the KMS client used to generate and decrypt the data keys, so the calls are cancelled with the context
+type KMSAPI interface {
+	GenerateDataKeyWithContext(ctx aws.Context, input *kms.GenerateDataKeyInput, opts ...request.Option) (*kms.GenerateDataKeyOutput, error)
+	DecryptWithContext(ctx aws.Context, input *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error)
+}
+
+// KMSKeyProvider generates the data keys with an AWS KMS key, so the master key never leaves KMS
+type KMSKeyProvider struct {
+	client KMSAPI
+	keyId  string
+}
+
+// NewKMSKeyProvider returns a provider that uses the KMS key with the given ID, ARN or alias
+func NewKMSKeyProvider(client KMSAPI, keyId string) *KMSKeyProvider {
+	return &KMSKeyProvider{client: client, keyId: keyId}
+}
+
+func (p *KMSKeyProvider) KeyId() string {
+	return p.keyId
+}
+
+func (p *KMSKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	result, err := p.client.GenerateDataKeyWithContext(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(p.keyId),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result.Plaintext, result.CiphertextBlob, nil
+}
+
+func (p *KMSKeyProvider) DecryptDataKey(ctx context.Context, keyId string, encrypted []byte) ([]byte, error) {
+	result, err := p.client.DecryptWithContext(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(keyId),
+		CiphertextBlob: encrypted,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Plaintext, nil
+}
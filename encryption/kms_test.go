@@ -0,0 +1,55 @@
+package encryption_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/inaciogu/go-sqs/encryption"
+	"github.com/inaciogu/go-sqs/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ encryption.KMSAPI = (*kms.KMS)(nil)
+
+type contextKey struct{}
+
+func (u *UnitTest) TestKMSKeyProvider() {
+	mockKMS := new(mocks.KMSAPI)
+	dataKey := bytes.Repeat([]byte("d"), 32)
+	ctx := context.WithValue(context.Background(), contextKey{}, "fake-value")
+
+	mockKMS.On("GenerateDataKeyWithContext", ctx, mock.MatchedBy(func(input *kms.GenerateDataKeyInput) bool {
+		return *input.KeyId == "alias/fake-key" && *input.KeySpec == kms.DataKeySpecAes256
+	})).Return(&kms.GenerateDataKeyOutput{
+		Plaintext:      dataKey,
+		CiphertextBlob: []byte("fake-encrypted-data-key"),
+	}, nil)
+
+	mockKMS.On("DecryptWithContext", ctx, mock.MatchedBy(func(input *kms.DecryptInput) bool {
+		return *input.KeyId == "alias/fake-key" && string(input.CiphertextBlob) == "fake-encrypted-data-key"
+	})).Return(&kms.DecryptOutput{Plaintext: dataKey}, nil)
+
+	provider := encryption.NewKMSKeyProvider(mockKMS, "alias/fake-key")
+
+	body, attributes, err := encryption.Encrypt(ctx, provider, "fake-content")
+
+	u.NoError(err)
+	u.Equal("alias/fake-key", attributes[encryption.KeyIdAttribute])
+
+	content, err := encryption.Decrypt(ctx, provider, body, attributes)
+
+	u.NoError(err)
+	u.Equal("fake-content", content)
+}
+
+func (u *UnitTest) TestKMSKeyProvider_Error() {
+	mockKMS := new(mocks.KMSAPI)
+
+	mockKMS.On("GenerateDataKeyWithContext", mock.Anything, mock.Anything).Return(nil, errors.New("AccessDeniedException"))
+
+	_, _, err := encryption.Encrypt(context.Background(), encryption.NewKMSKeyProvider(mockKMS, "alias/fake-key"), "fake-content")
+
+	u.EqualError(err, "failed to generate data key: AccessDeniedException")
+}
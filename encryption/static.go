@@ -0,0 +1,49 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+)
+
+// StaticKeyProvider encrypts the data keys with a fixed 256-bit master key. It is meant for tests and local development.
+type StaticKeyProvider struct {
+	keyId string
+	key   []byte
+}
+
+func NewStaticKeyProvider(keyId string, key []byte) (*StaticKeyProvider, error) {
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("invalid key size %d, expected %d bytes", len(key), dataKeySize)
+	}
+
+	return &StaticKeyProvider{keyId: keyId, key: key}, nil
+}
+
+func (p *StaticKeyProvider) KeyId() string {
+	return p.keyId
+}
+
+func (p *StaticKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	plaintext := make([]byte, dataKeySize)
+
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, nil, err
+	}
+
+	encrypted, err := seal(p.key, plaintext, []byte(p.keyId))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return plaintext, encrypted, nil
+}
+
+func (p *StaticKeyProvider) DecryptDataKey(ctx context.Context, keyId string, encrypted []byte) ([]byte, error) {
+	if keyId != p.keyId {
+		return nil, fmt.Errorf("unknown key %s", keyId)
+	}
+
+	return open(p.key, encrypted, []byte(keyId))
+}
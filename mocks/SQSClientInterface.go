@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	sqs "github.com/aws/aws-sdk-go/service/sqs"
 	mock "github.com/stretchr/testify/mock"
 )
@@ -12,6 +14,20 @@ type SQSClientInterface struct {
 	mock.Mock
 }
 
+// GetQueueName provides a mock function with given fields:
+func (_m *SQSClientInterface) GetQueueName() string {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
 // GetQueueUrl provides a mock function with given fields:
 func (_m *SQSClientInterface) GetQueueUrl() *string {
 	ret := _m.Called()
@@ -68,6 +84,20 @@ func (_m *SQSClientInterface) ReceiveMessages(queueUrl string, ch chan *sqs.Mess
 	return r0
 }
 
+// Run provides a mock function with given fields: ctx
+func (_m *SQSClientInterface) Run(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Start provides a mock function with given fields:
 func (_m *SQSClientInterface) Start() {
 	_m.Called()
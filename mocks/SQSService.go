@@ -40,6 +40,32 @@ func (_m *SQSService) ChangeMessageVisibility(input *sqs.ChangeMessageVisibility
 	return r0, r1
 }
 
+// ChangeMessageVisibilityBatch provides a mock function with given fields: input
+func (_m *SQSService) ChangeMessageVisibilityBatch(input *sqs.ChangeMessageVisibilityBatchInput) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	ret := _m.Called(input)
+
+	var r0 *sqs.ChangeMessageVisibilityBatchOutput
+	var r1 error
+	if rf, ok := ret.Get(0).(func(*sqs.ChangeMessageVisibilityBatchInput) (*sqs.ChangeMessageVisibilityBatchOutput, error)); ok {
+		return rf(input)
+	}
+	if rf, ok := ret.Get(0).(func(*sqs.ChangeMessageVisibilityBatchInput) *sqs.ChangeMessageVisibilityBatchOutput); ok {
+		r0 = rf(input)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*sqs.ChangeMessageVisibilityBatchOutput)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(*sqs.ChangeMessageVisibilityBatchInput) error); ok {
+		r1 = rf(input)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeleteMessage provides a mock function with given fields: input
 func (_m *SQSService) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
 	ret := _m.Called(input)
@@ -66,6 +92,58 @@ func (_m *SQSService) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteM
 	return r0, r1
 }
 
+// DeleteMessageBatch provides a mock function with given fields: input
+func (_m *SQSService) DeleteMessageBatch(input *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error) {
+	ret := _m.Called(input)
+
+	var r0 *sqs.DeleteMessageBatchOutput
+	var r1 error
+	if rf, ok := ret.Get(0).(func(*sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error)); ok {
+		return rf(input)
+	}
+	if rf, ok := ret.Get(0).(func(*sqs.DeleteMessageBatchInput) *sqs.DeleteMessageBatchOutput); ok {
+		r0 = rf(input)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*sqs.DeleteMessageBatchOutput)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(*sqs.DeleteMessageBatchInput) error); ok {
+		r1 = rf(input)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetQueueAttributes provides a mock function with given fields: input
+func (_m *SQSService) GetQueueAttributes(input *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error) {
+	ret := _m.Called(input)
+
+	var r0 *sqs.GetQueueAttributesOutput
+	var r1 error
+	if rf, ok := ret.Get(0).(func(*sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error)); ok {
+		return rf(input)
+	}
+	if rf, ok := ret.Get(0).(func(*sqs.GetQueueAttributesInput) *sqs.GetQueueAttributesOutput); ok {
+		r0 = rf(input)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*sqs.GetQueueAttributesOutput)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(*sqs.GetQueueAttributesInput) error); ok {
+		r1 = rf(input)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetQueueUrl provides a mock function with given fields: input
 func (_m *SQSService) GetQueueUrl(input *sqs.GetQueueUrlInput) (*sqs.GetQueueUrlOutput, error) {
 	ret := _m.Called(input)
@@ -146,6 +224,32 @@ func (_m *SQSService) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.Recei
 	return r0, r1
 }
 
+// SendMessage provides a mock function with given fields: input
+func (_m *SQSService) SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
+	ret := _m.Called(input)
+
+	var r0 *sqs.SendMessageOutput
+	var r1 error
+	if rf, ok := ret.Get(0).(func(*sqs.SendMessageInput) (*sqs.SendMessageOutput, error)); ok {
+		return rf(input)
+	}
+	if rf, ok := ret.Get(0).(func(*sqs.SendMessageInput) *sqs.SendMessageOutput); ok {
+		r0 = rf(input)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*sqs.SendMessageOutput)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(*sqs.SendMessageInput) error); ok {
+		r1 = rf(input)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewSQSService creates a new instance of SQSService. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewSQSService(t interface {
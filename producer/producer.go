@@ -0,0 +1,183 @@
+package producer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/codec"
+	"github.com/inaciogu/go-sqs/compression"
+	"github.com/inaciogu/go-sqs/encryption"
+)
+
+// SQSSender is the subset of the SQS client used to send messages
+type SQSSender interface {
+	SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error)
+}
+
+type SQSProducerOptions struct {
+	QueueUrl string
+	// Codec encodes the values passed to Send. Its content type is sent in the content-type attribute. Defaults to JSON.
+	Codec codec.Codec
+	// Compression compresses the bodies with gzip or zstd and sets the content-encoding attribute, so consumers decompress them transparently.
+	// Bodies are not compressed when empty.
+	Compression string
+	// Encryption encrypts the bodies with a data key generated by the provider, after they are compressed.
+	// The encrypted data key and the ID of the master key are sent in message attributes. Bodies are not encrypted when nil.
+	Encryption encryption.KeyProvider
+	// Region is the region of the queue. Defaults to the region of the shared config, then to DefaultRegion.
+	Region string
+	// Endpoint overrides the endpoint of SQS, e.g. for LocalStack
+	Endpoint string
+}
+
+type SQSProducer struct {
+	Client          SQSSender
+	ProducerOptions *SQSProducerOptions
+}
+
+const DefaultRegion = "us-east-1"
+
+func New(sqsService SQSSender, options SQSProducerOptions) *SQSProducer {
+	if options.QueueUrl == "" {
+		panic("QueueUrl is required")
+	}
+
+	setDefaultOptions(&options)
+
+	if sqsService == nil {
+		sqsService = newSQSService(options)
+	}
+
+	return &SQSProducer{
+		Client:          sqsService,
+		ProducerOptions: &options,
+	}
+}
+
+func setDefaultOptions(options *SQSProducerOptions) {
+	if options.Codec == nil {
+		options.Codec = codec.JSON
+	}
+}
+
+// newSQSService builds the SQS client used when none is passed to New, like the consumer does: credentials are resolved
+// by the default chain of the SDK and the shared config is loaded, so the region of the profile is used.
+func newSQSService(options SQSProducerOptions) *sqs.SQS {
+	config := aws.Config{}
+
+	if options.Region != "" {
+		config.Region = aws.String(options.Region)
+	}
+
+	// An empty endpoint would override the one resolved for the region
+	if options.Endpoint != "" {
+		config.Endpoint = aws.String(options.Endpoint)
+	}
+
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		Config:            config,
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.Region = aws.String(DefaultRegion)
+	}
+
+	return sqs.New(sess)
+}
+
+// reservedAttributes are the attributes set by the producer, which consumers need to decode the messages
+var reservedAttributes = map[string]bool{
+	codec.ContentTypeAttribute:    true,
+	compression.EncodingAttribute: true,
+	encryption.KeyIdAttribute:     true,
+	encryption.DataKeyAttribute:   true,
+	encryption.AlgorithmAttribute: true,
+}
+
+// Send encodes v with the codec of the producer and sends it with the given string attributes. It returns the ID of the message.
+// It returns an error when the attributes include one set by the producer, e.g. content-type, since the message could not be decoded.
+func (p *SQSProducer) Send(v interface{}, attributes map[string]string) (string, error) {
+	if err := checkAttributes(attributes); err != nil {
+		return "", err
+	}
+
+	body, err := codec.Encode(p.ProducerOptions.Codec, v)
+
+	if err != nil {
+		return "", err
+	}
+
+	messageAttributes := map[string]*sqs.MessageAttributeValue{
+		codec.ContentTypeAttribute: stringAttribute(p.ProducerOptions.Codec.ContentType()),
+	}
+
+	if p.ProducerOptions.Compression != "" {
+		body, err = compression.Encode(p.ProducerOptions.Compression, body)
+
+		if err != nil {
+			return "", err
+		}
+
+		messageAttributes[compression.EncodingAttribute] = stringAttribute(p.ProducerOptions.Compression)
+	}
+
+	if p.ProducerOptions.Encryption != nil {
+		encrypted, encryptionAttributes, err := encryption.Encrypt(context.Background(), p.ProducerOptions.Encryption, body)
+
+		if err != nil {
+			return "", err
+		}
+
+		body = encrypted
+
+		for key, value := range encryptionAttributes {
+			messageAttributes[key] = stringAttribute(value)
+		}
+	}
+
+	for key, value := range attributes {
+		messageAttributes[key] = stringAttribute(value)
+	}
+
+	result, err := p.Client.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:          aws.String(p.ProducerOptions.QueueUrl),
+		MessageBody:       aws.String(body),
+		MessageAttributes: messageAttributes,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(result.MessageId), nil
+}
+
+func checkAttributes(attributes map[string]string) error {
+	reserved := []string{}
+
+	for key := range attributes {
+		if reservedAttributes[key] {
+			reserved = append(reserved, key)
+		}
+	}
+
+	if len(reserved) == 0 {
+		return nil
+	}
+
+	sort.Strings(reserved)
+
+	return fmt.Errorf("attributes %v are reserved by the producer", reserved)
+}
+
+func stringAttribute(value string) *sqs.MessageAttributeValue {
+	return &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+}
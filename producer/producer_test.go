@@ -0,0 +1,237 @@
+package producer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inaciogu/go-sqs/codec"
+	"github.com/inaciogu/go-sqs/compression"
+	"github.com/inaciogu/go-sqs/consumer/message"
+	"github.com/inaciogu/go-sqs/encryption"
+	"github.com/inaciogu/go-sqs/mocks"
+	"github.com/inaciogu/go-sqs/producer"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type UnitTest struct {
+	suite.Suite
+	mockSQSSender *mocks.SQSSender
+}
+
+func (u *UnitTest) SetupTest() {
+	u.mockSQSSender = new(mocks.SQSSender)
+}
+
+func TestUnitSuites(t *testing.T) {
+	suite.Run(t, &UnitTest{})
+}
+
+type user struct {
+	Name string `json:"name" msgpack:"name"`
+}
+
+func (u *UnitTest) TestNewWithoutQueueUrl() {
+	u.Panics(func() {
+		producer.New(u.mockSQSSender, producer.SQSProducerOptions{})
+	})
+}
+
+// isolateAWSEnvironment keeps the credentials and config of the machine out of the test
+func (u *UnitTest) isolateAWSEnvironment() string {
+	dir := u.T().TempDir()
+
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_CA_BUNDLE"} {
+		u.T().Setenv(name, "")
+	}
+
+	u.T().Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	u.T().Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	u.T().Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	return dir
+}
+
+func (u *UnitTest) TestNewWithoutSQSService() {
+	dir := u.isolateAWSEnvironment()
+
+	u.Require().NoError(os.WriteFile(filepath.Join(dir, "config"), []byte("[default]\nregion = eu-west-1\n"), 0600))
+	u.Require().NoError(os.WriteFile(filepath.Join(dir, "credentials"), []byte("[default]\naws_access_key_id = PROFILE_ACCESS_KEY\naws_secret_access_key = fake-secret\n"), 0600))
+
+	client := producer.New(nil, producer.SQSProducerOptions{QueueUrl: "https://fake-queue-url"}).Client.(*sqs.SQS)
+
+	credentials, err := client.Config.Credentials.Get()
+
+	u.NoError(err)
+	u.Equal("PROFILE_ACCESS_KEY", credentials.AccessKeyID)
+	u.Equal("eu-west-1", *client.Config.Region)
+	u.Equal("https://sqs.eu-west-1.amazonaws.com", client.Endpoint)
+}
+
+func (u *UnitTest) TestNewWithoutSQSService_Endpoint() {
+	u.isolateAWSEnvironment()
+
+	client := producer.New(nil, producer.SQSProducerOptions{
+		QueueUrl: "http://localhost:4566/000000000000/fake-queue-name",
+		Endpoint: "http://localhost:4566",
+	}).Client.(*sqs.SQS)
+
+	u.Equal(producer.DefaultRegion, *client.Config.Region)
+	u.Equal("http://localhost:4566", client.Endpoint)
+}
+
+func (u *UnitTest) TestSend() {
+	u.mockSQSSender.On("SendMessage", mock.Anything).Return(&sqs.SendMessageOutput{
+		MessageId: aws.String("fake-message-id"),
+	}, nil)
+
+	p := producer.New(u.mockSQSSender, producer.SQSProducerOptions{QueueUrl: "https://fake-queue-url"})
+
+	messageId, err := p.Send(user{Name: "test"}, map[string]string{"eventType": "user.created"})
+
+	u.NoError(err)
+	u.Equal("fake-message-id", messageId)
+	u.mockSQSSender.AssertCalled(u.T(), "SendMessage", mock.MatchedBy(func(input *sqs.SendMessageInput) bool {
+		return *input.QueueUrl == "https://fake-queue-url" &&
+			*input.MessageBody == `{"name":"test"}` &&
+			*input.MessageAttributes["content-type"].StringValue == "application/json" &&
+			*input.MessageAttributes["eventType"].StringValue == "user.created"
+	}))
+}
+
+func (u *UnitTest) TestSend_BinaryCodec() {
+	u.mockSQSSender.On("SendMessage", mock.Anything).Return(&sqs.SendMessageOutput{
+		MessageId: aws.String("fake-message-id"),
+	}, nil)
+
+	p := producer.New(u.mockSQSSender, producer.SQSProducerOptions{
+		QueueUrl: "https://fake-queue-url",
+		Codec:    codec.MessagePack,
+	})
+
+	_, err := p.Send(user{Name: "test"}, nil)
+
+	u.NoError(err)
+
+	input := u.mockSQSSender.Calls[0].Arguments.Get(0).(*sqs.SendMessageInput)
+	decoded := user{}
+
+	u.Equal("application/x-msgpack", *input.MessageAttributes["content-type"].StringValue)
+	u.NoError(codec.Decode(codec.MessagePack, *input.MessageBody, &decoded))
+	u.Equal(user{Name: "test"}, decoded)
+}
+
+func (u *UnitTest) TestSend_Compression() {
+	u.mockSQSSender.On("SendMessage", mock.Anything).Return(&sqs.SendMessageOutput{
+		MessageId: aws.String("fake-message-id"),
+	}, nil)
+
+	p := producer.New(u.mockSQSSender, producer.SQSProducerOptions{
+		QueueUrl:    "https://fake-queue-url",
+		Compression: compression.Zstd,
+	})
+
+	_, err := p.Send(user{Name: "test"}, nil)
+
+	u.NoError(err)
+
+	input := u.mockSQSSender.Calls[0].Arguments.Get(0).(*sqs.SendMessageInput)
+	body, err := compression.Decode(compression.Zstd, *input.MessageBody)
+
+	u.NoError(err)
+	u.Equal(`{"name":"test"}`, body)
+	u.Equal("zstd", *input.MessageAttributes["content-encoding"].StringValue)
+}
+
+func (u *UnitTest) TestSend_UnknownCompression() {
+	p := producer.New(u.mockSQSSender, producer.SQSProducerOptions{
+		QueueUrl:    "https://fake-queue-url",
+		Compression: "br",
+	})
+
+	_, err := p.Send(user{Name: "test"}, nil)
+
+	u.EqualError(err, "unknown content encoding br")
+	u.mockSQSSender.AssertNotCalled(u.T(), "SendMessage", mock.Anything)
+}
+
+func (u *UnitTest) TestSend_Encryption() {
+	u.mockSQSSender.On("SendMessage", mock.Anything).Return(&sqs.SendMessageOutput{
+		MessageId: aws.String("fake-message-id"),
+	}, nil)
+
+	provider, _ := encryption.NewStaticKeyProvider("fake-key-id", bytes.Repeat([]byte("k"), 32))
+
+	p := producer.New(u.mockSQSSender, producer.SQSProducerOptions{
+		QueueUrl:    "https://fake-queue-url",
+		Compression: compression.Gzip,
+		Encryption:  provider,
+	})
+
+	_, err := p.Send(user{Name: "test"}, nil)
+
+	u.NoError(err)
+
+	input := u.mockSQSSender.Calls[0].Arguments.Get(0).(*sqs.SendMessageInput)
+
+	u.Equal("fake-key-id", *input.MessageAttributes["encryption-key-id"].StringValue)
+	u.Equal("gzip", *input.MessageAttributes["content-encoding"].StringValue)
+
+	// The consumer decrypts the body, then decompresses it
+	received, err := message.Parse(&sqs.Message{
+		MessageId:         aws.String("fake-message-id"),
+		ReceiptHandle:     aws.String("fake-receipt-handle"),
+		Body:              input.MessageBody,
+		MessageAttributes: input.MessageAttributes,
+	})
+
+	u.NoError(err)
+	u.NoError(received.Decrypt(context.Background(), provider))
+	u.Equal(`{"name":"test"}`, received.Content)
+}
+
+func (u *UnitTest) TestSend_ReservedAttributes() {
+	provider, _ := encryption.NewStaticKeyProvider("fake-key-id", bytes.Repeat([]byte("k"), 32))
+
+	p := producer.New(u.mockSQSSender, producer.SQSProducerOptions{
+		QueueUrl:   "https://fake-queue-url",
+		Encryption: provider,
+	})
+
+	_, err := p.Send(user{Name: "test"}, map[string]string{
+		"eventType":         "user.created",
+		"content-type":      "text/plain",
+		"encryption-key-id": "other-key-id",
+	})
+
+	u.EqualError(err, "attributes [content-type encryption-key-id] are reserved by the producer")
+	u.mockSQSSender.AssertNotCalled(u.T(), "SendMessage", mock.Anything)
+}
+
+func (u *UnitTest) TestSend_EncodeError() {
+	p := producer.New(u.mockSQSSender, producer.SQSProducerOptions{
+		QueueUrl: "https://fake-queue-url",
+		Codec:    codec.Protobuf,
+	})
+
+	_, err := p.Send(user{Name: "test"}, nil)
+
+	u.Error(err)
+	u.mockSQSSender.AssertNotCalled(u.T(), "SendMessage", mock.Anything)
+}
+
+func (u *UnitTest) TestSend_Error() {
+	u.mockSQSSender.On("SendMessage", mock.Anything).Return(nil, errors.New("Error"))
+
+	p := producer.New(u.mockSQSSender, producer.SQSProducerOptions{QueueUrl: "https://fake-queue-url"})
+
+	_, err := p.Send(user{Name: "test"}, nil)
+
+	u.EqualError(err, "Error")
+}